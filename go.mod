@@ -7,6 +7,7 @@ replace k8s.io/client-go => k8s.io/client-go v0.20.2
 require (
 	github.com/evanphx/json-patch v4.9.0+incompatible
 	github.com/go-logr/logr v0.3.0
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/rancher/fleet/pkg/apis v0.0.0-20210225010648-40ee92df4aea
 	github.com/rancher/lasso v0.0.0-20210219163000-fcdfcec12969
 	github.com/rancher/lasso/controller-runtime v0.0.0-20210219163000-fcdfcec12969
@@ -20,6 +21,8 @@ require (
 	k8s.io/apiextensions-apiserver v0.20.2
 	k8s.io/apimachinery v0.20.2
 	k8s.io/client-go v12.0.0+incompatible
+	k8s.io/kubectl v0.20.2
+	k8s.io/utils v0.0.0-20210111153108-fddb29f9d009
 	sigs.k8s.io/cluster-api v0.0.0
 	sigs.k8s.io/controller-runtime v0.8.2
 )
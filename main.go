@@ -1,7 +1,7 @@
 //go:generate go run pkg/codegen/cleanup/main.go
 //go:generate go run pkg/codegen/main.go
-//go:generate go run main.go --write-crds ./charts/rancher-operator-crd/templates/crds.yaml
-//go:generate go run main.go --write-capi-crds ./charts/rancher-operator-crd/charts/capi/templates/crds.yaml
+//go:generate go run . --write-crds ./charts/rancher-operator-crd/templates/crds.yaml
+//go:generate go run . --write-capi-crds ./charts/rancher-operator-crd/charts/capi/templates/crds.yaml
 
 package main
 
@@ -74,6 +74,9 @@ func main() {
 		},
 	}
 	app.Action = run
+	app.Commands = []cli.Command{
+		previewCommand,
+	}
 
 	if err := app.Run(os.Args); err != nil {
 		logrus.Fatal(err)
@@ -32,6 +32,16 @@ type ClusterStatus struct {
 	AgentDeployed      bool                                `json:"agentDeployed,omitempty"`
 	ObservedGeneration int64                               `json:"observedGeneration"`
 	Conditions         []genericcondition.GenericCondition `json:"conditions,omitempty"`
+	// NodePools is the current size of each node pool of the rke config
+	NodePools []RKENodePoolStatus `json:"nodePools,omitempty"`
+}
+
+type RKENodePoolStatus struct {
+	Name string `json:"name,omitempty"`
+	// Replicas is the desired size of the pool, set by the cluster autoscaler if the pool is autoscaled
+	Replicas      int32 `json:"replicas,omitempty"`
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	Autoscaled    bool  `json:"autoscaled,omitempty"`
 }
 
 type ImportedConfig struct {
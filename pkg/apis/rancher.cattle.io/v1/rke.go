@@ -3,21 +3,43 @@ package v1
 import (
 	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
 )
 
 type RKENodePool struct {
 	rkev1.RKECommonNodeConfig
 
-	Paused           bool                         `json:"paused,omitempty"`
-	EtcdRole         *bool                        `json:"etcdRole,omitempty" wrangler:"default=true"`
-	ControlPlaneRole *bool                        `json:"controlPlaneRole,omitempty" wrangler:"default=true"`
-	WorkerRole       *bool                        `json:"workerRole,omitempty" wrangler:"default=true"`
-	NodeConfig       *corev1.ObjectReference      `json:"nodeConfig,omitempty" wrangler:"required"`
-	Name             string                       `json:"name,omitempty" wrangler:"required"`
-	DisplayName      string                       `json:"displayName,omitempty"`
-	Quantity         *int32                       `json:"quantity,omitempty"`
-	RollingUpdate    *RKEMachinePoolRollingUpdate `json:"rollingUpdate,omitempty"`
+	Paused           bool                    `json:"paused,omitempty"`
+	EtcdRole         *bool                   `json:"etcdRole,omitempty" wrangler:"default=true"`
+	ControlPlaneRole *bool                   `json:"controlPlaneRole,omitempty" wrangler:"default=true"`
+	WorkerRole       *bool                   `json:"workerRole,omitempty" wrangler:"default=true"`
+	NodeConfig       *corev1.ObjectReference `json:"nodeConfig,omitempty" wrangler:"required"`
+	Name             string                  `json:"name,omitempty" wrangler:"required"`
+	DisplayName      string                  `json:"displayName,omitempty"`
+	Quantity         *int32                  `json:"quantity,omitempty"`
+	// MinSize and MaxSize hand the size of the pool to the cluster autoscaler once both are set and MinSize does not
+	// exceed MaxSize. Quantity is then only the initial size, the replicas are owned by the autoscaler.
+	MinSize       *int32                       `json:"minSize,omitempty"`
+	MaxSize       *int32                       `json:"maxSize,omitempty"`
+	RollingUpdate *RKEMachinePoolRollingUpdate `json:"rollingUpdate,omitempty"`
+	// MachineHealthCheck configures the health check of the machines of the pool, the defaults are used if nil
+	MachineHealthCheck *RKEMachinePoolHealthCheck `json:"machineHealthCheck,omitempty"`
+}
+
+type RKEMachinePoolHealthCheck struct {
+	// Remediation deletes unhealthy machines so they are replaced, defaults to true. Unhealthy machines of etcd and
+	// control plane pools are only remediated as long as enough machines of that role are left to keep quorum.
+	Remediation *bool `json:"remediation,omitempty"`
+	// The conditions of the node that make a machine unhealthy once they lasted longer than their timeout, defaults
+	// to the Ready condition being False or Unknown for 5 minutes
+	UnhealthyConditions []capi.UnhealthyCondition `json:"unhealthyConditions,omitempty"`
+	// Remediation stops while more machines of the pool are unhealthy, an absolute number (ex: 2) or a percentage of
+	// the machines of the pool (ex: 40%). Defaults to 100%.
+	MaxUnhealthy *intstr.IntOrString `json:"maxUnhealthy,omitempty"`
+	// Machines without a node after this long are unhealthy, defaults to 10 minutes
+	NodeStartupTimeout *metav1.Duration `json:"nodeStartupTimeout,omitempty"`
 }
 
 type RKEMachinePoolRollingUpdate struct {
@@ -16,19 +16,123 @@ type RKECluster struct {
 }
 
 type RKEClusterStatus struct {
-	Conditions             []genericcondition.GenericCondition `json:"conditions,omitempty"`
-	Ready                  bool                                `json:"ready,omitempty"`
-	ObservedGeneration     int64                               `json:"observedGeneration"`
-	ClusterStateSecretName string                              `json:"clusterStateSecretName,omitempty"`
+	Conditions                       []genericcondition.GenericCondition `json:"conditions,omitempty"`
+	Ready                            bool                                `json:"ready,omitempty"`
+	ObservedGeneration               int64                               `json:"observedGeneration"`
+	ClusterStateSecretName           string                              `json:"clusterStateSecretName,omitempty"`
+	ETCDSnapshotCreateGeneration     int64                               `json:"etcdSnapshotCreateGeneration,omitempty"`
+	ETCDSnapshotRestore              *ETCDSnapshotRestore                `json:"etcdSnapshotRestore,omitempty"`
+	ETCDSnapshotRestorePhase         string                              `json:"etcdSnapshotRestorePhase,omitempty"`
+	CertificateRotationGeneration    int64                               `json:"certificateRotationGeneration,omitempty"`
+	JoinTokenRotationGeneration      int64                               `json:"joinTokenRotationGeneration,omitempty"`
+	PlanSigningKeyRotationGeneration int64                               `json:"planSigningKeyRotationGeneration,omitempty"`
+	// EncryptionKeyRotationPhase is Prepare, Rotate or Reencrypt while the keys are rotated, the command of each phase
+	// runs on EncryptionKeyRotationLeader before all control plane machines are restarted one at a time
+	EncryptionKeyRotationGeneration int64  `json:"encryptionKeyRotationGeneration,omitempty"`
+	EncryptionKeyRotationPhase      string `json:"encryptionKeyRotationPhase,omitempty"`
+	EncryptionKeyRotationLeader     string `json:"encryptionKeyRotationLeader,omitempty"`
+	// InitNode is the machine other machines join through, ClusterInitNode the machine that initialized the cluster.
+	// InitNodeUnhealthySince is set while the init node is not healthy, it is replaced once that lasts too long.
+	InitNode               string       `json:"initNode,omitempty"`
+	ClusterInitNode        string       `json:"clusterInitNode,omitempty"`
+	InitNodeUnhealthySince *metav1.Time `json:"initNodeUnhealthySince,omitempty"`
+	// PlanRevision is the revision of the plans being rolled out, PlanRevisions the most recent revisions
+	PlanRevision  int64          `json:"planRevision,omitempty"`
+	PlanRevisions []PlanRevision `json:"planRevisions,omitempty"`
+	// KubernetesVersion is the version every machine runs. UpgradePhase is Etcd, ControlPlane or Workers while the
+	// machines are upgraded from UpgradeFromVersion to UpgradeToVersion and Done once the upgrade completed.
+	KubernetesVersion  string `json:"kubernetesVersion,omitempty"`
+	UpgradeFromVersion string `json:"upgradeFromVersion,omitempty"`
+	UpgradeToVersion   string `json:"upgradeToVersion,omitempty"`
+	UpgradePhase       string `json:"upgradePhase,omitempty"`
+	// HeldMachines are the machines that keep their current plan because of the rke.cattle.io/hold annotation
+	HeldMachines []string `json:"heldMachines,omitempty"`
 }
 
 type RKEClusterSpecCommon struct {
 	UpgradeStrategy ClusterUpgradeStrategy `json:"upgradeStrategy,omitempty"`
-	Config          []RKESystemConfig      `json:"config,omitempty"`
+	// Config is applied to each machine in order, starting from the default config of the Kubernetes version.
+	// Every matching entry is deep merged on top of the previous result, so later entries take precedence.
+	// The keys token, agent-token, server, cluster-init and node-label are computed by the planner and
+	// can not be overridden. The keys node-taint, tls-san, secrets-encryption, disable-apiserver,
+	// disable-controller-manager, disable-scheduler, disable-etcd and the etcd-snapshot and etcd-s3 keys are
+	// overridden when the machine or the cluster spec configure them.
+	Config              []RKESystemConfig    `json:"config,omitempty"`
+	ETCD                *ETCD                `json:"etcd,omitempty"`
+	ETCDSnapshotCreate  *ETCDSnapshotCreate  `json:"etcdSnapshotCreate,omitempty"`
+	ETCDSnapshotRestore *ETCDSnapshotRestore `json:"etcdSnapshotRestore,omitempty"`
+	RotateCertificates  *RotateCertificates  `json:"rotateCertificates,omitempty"`
+	RotateJoinTokens    *RotateJoinTokens    `json:"rotateJoinTokens,omitempty"`
+	// SecretsEncryption encrypts secrets at rest in the datastore
+	SecretsEncryption    bool                  `json:"secretsEncryption,omitempty"`
+	RotateEncryptionKeys *RotateEncryptionKeys `json:"rotateEncryptionKeys,omitempty"`
+	RotatePlanSigningKey *RotatePlanSigningKey `json:"rotatePlanSigningKey,omitempty"`
+	PlanRollback         *PlanRollback         `json:"planRollback,omitempty"`
+	// Registries is rendered to the registries.yaml of every machine, credentials are read from secrets
+	Registries *Registry `json:"registries,omitempty"`
+	// AdditionalManifest is YAML deployed to the cluster by every control plane machine
+	AdditionalManifest string `json:"additionalManifest,omitempty"`
+	// ChartValues are the values of the charts bundled with the runtime, such as rke2-canal or traefik, keyed by
+	// chart name
+	ChartValues GenericMap `json:"chartValues,omitempty" wrangler:"nullable"`
+	// RegistrationEndpoint is a load balancer or DNS name in front of the servers, forwarding the supervisor and
+	// Kubernetes API ports. Machines join through it instead of the init node and it is added to the TLS SANs of the
+	// servers.
+	RegistrationEndpoint string `json:"registrationEndpoint,omitempty"`
+	// Paused stops the planner from writing new plans, the status of the cluster is still updated. Single machines
+	// are held back with the rke.cattle.io/hold annotation.
+	Paused bool `json:"paused,omitempty"`
+}
+
+type PlanRollback struct {
+	// Revision of status.planRevisions to roll back to. While set, machines are rolled out with the Kubernetes
+	// version, files and config they applied for that revision, only tokens, keys and credentials follow the current
+	// spec. The machines ran that version before, so a rollback may downgrade the cluster or interrupt an upgrade.
+	// The rollback is rolled out as a revision of its own.
+	Revision int64 `json:"revision,omitempty"`
+}
+
+type PlanRevision struct {
+	Revision int64 `json:"revision,omitempty"`
+	// Generation of the spec that produced the plans of the revision
+	Generation int64 `json:"generation,omitempty"`
+	// KubernetesVersion rolled out by the plans of the revision
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// RollbackTo is the revision this revision rolled back to, if any
+	RollbackTo int64 `json:"rollbackTo,omitempty"`
+}
+
+type RotateCertificates struct {
+	// Changing the generation rotates the certificates of all machines, etcd first, then control plane, then workers
+	Generation int64 `json:"generation,omitempty"`
+	// Services to rotate the certificates of, such as api-server or etcd. All services if empty.
+	Services []string `json:"services,omitempty"`
+}
+
+type RotateJoinTokens struct {
+	// Changing the generation issues new server and agent join tokens and rolls them out to servers, then agents.
+	// The previous tokens stay valid until every machine is in sync.
+	Generation int64 `json:"generation,omitempty"`
+}
+
+type RotateEncryptionKeys struct {
+	// Changing the generation rotates the secrets encryption keys and re-encrypts all secrets with the new key,
+	// requires SecretsEncryption
+	Generation int64 `json:"generation,omitempty"`
+}
+
+type RotatePlanSigningKey struct {
+	// Changing the generation issues a new key to sign plans with. Machines trust the previous and the new key until
+	// every machine is in sync, then plans are signed with the new key. The keys are written to the machines without
+	// reinstalling or draining them.
+	Generation int64 `json:"generation,omitempty"`
 }
 
 type RKESystemConfig struct {
-	MachineName          string                `json:"machineName,omitempty"`
+	// The name of the machine this config applies to, any machine selected by MachineLabelSelector if empty
+	MachineName string `json:"machineName,omitempty"`
+	// Selects the machines this config applies to by their labels, an empty selector selects all machines. Without
+	// a selector the config only applies to the machine named by MachineName.
 	MachineLabelSelector *metav1.LabelSelector `json:"machineLabelSelector,omitempty"`
 	Config               GenericMap            `json:"config,omitempty"`
 }
@@ -36,7 +140,8 @@ type RKESystemConfig struct {
 type RKEClusterSpec struct {
 	RKEClusterSpecCommon
 
-	// Not used in anyway, just here to make cluster-api happy
+	// The Kubernetes API of the cluster, the registration endpoint if set and localhost otherwise. It is kept in sync
+	// with the spec and the CAPI Cluster by the operator.
 	ControlPlaneEndpoint      *Endpoint `json:"controlPlaneEndpoint,omitempty"`
 	KubernetesVersion         string    `json:"kubernetesVersion,omitempty"`
 	CloudCredentialSecretName string    `json:"cloudCredentialSecretName,omitempty"`
@@ -46,12 +151,32 @@ type RKEClusterSpec struct {
 type ClusterUpgradeStrategy struct {
 	// How many controlplane nodes should be upgrade at time, defaults to 1
 	ServerConcurrency int `json:"serverConcurrency,omitempty" norman:"min=1"`
-	// How many workers should be upgraded at a time
+	// How many workers should be upgraded at a time, defaults to 1
 	WorkerConcurrency int `json:"workerConcurrency,omitempty" norman:"min=1"`
 	// Whether controlplane nodes should be drained
 	DrainServerNodes bool `json:"drainServerNodes,omitempty"`
 	// Whether worker nodes should be drained
 	DrainWorkerNodes bool `json:"drainWorkerNodes,omitempty"`
+	// How nodes are drained when DrainServerNodes or DrainWorkerNodes is set
+	DrainOptions DrainOptions `json:"drainOptions,omitempty"`
+	// Number of failed attempts to apply a plan to a machine after which the rollout halts, defaults to 5.
+	// Failed plans are retried with a backoff until they succeed or are replaced.
+	MaxFailures int `json:"maxFailures,omitempty"`
+}
+
+type DrainOptions struct {
+	// Delete pods that are not managed by a controller
+	Force bool `json:"force,omitempty"`
+	// Ignore pods managed by a DaemonSet, defaults to true
+	IgnoreDaemonSets *bool `json:"ignoreDaemonSets,omitempty"`
+	// Delete pods using emptyDir volumes, the data of those volumes is lost
+	DeleteEmptyDirData bool `json:"deleteEmptyDirData,omitempty"`
+	// Seconds each pod is given to terminate, the grace period of the pod is used if 0
+	GracePeriod int `json:"gracePeriod,omitempty"`
+	// Seconds to wait for the drain to finish before retrying, defaults to 120
+	Timeout int `json:"timeout,omitempty"`
+	// Ignore pods that have been deleted longer ago than this many seconds, such as pods on a NotReady node
+	SkipWaitForDeleteTimeoutSeconds int `json:"skipWaitForDeleteTimeoutSeconds,omitempty"`
 }
 
 type Endpoint struct {
@@ -0,0 +1,58 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type ETCD struct {
+	// Disables the snapshots taken by the schedule, on-demand snapshots can still be created
+	DisableSnapshots bool `json:"disableSnapshots,omitempty"`
+	// Cron expression of the snapshot schedule, defaults to every 12 hours
+	SnapshotScheduleCron string `json:"snapshotScheduleCron,omitempty"`
+	// Number of snapshots to keep, defaults to 5
+	SnapshotRetention int `json:"snapshotRetention,omitempty"`
+	// Stores snapshots in S3 instead of the local disk of the etcd machines
+	S3 *ETCDSnapshotS3 `json:"s3,omitempty"`
+}
+
+type ETCDSnapshotS3 struct {
+	Endpoint      string `json:"endpoint,omitempty"`
+	EndpointCA    string `json:"endpointCA,omitempty"`
+	SkipSSLVerify bool   `json:"skipSSLVerify,omitempty"`
+	Bucket        string `json:"bucket,omitempty"`
+	Region        string `json:"region,omitempty"`
+	Folder        string `json:"folder,omitempty"`
+	// Name of a secret in the namespace of the cluster with the keys accessKey and secretKey
+	CredentialSecretName string `json:"credentialSecretName,omitempty"`
+}
+
+type ETCDSnapshotCreate struct {
+	// Changing the generation takes a new snapshot
+	Generation int64 `json:"generation,omitempty"`
+}
+
+type ETCDSnapshotRestore struct {
+	// Name of the ETCDSnapshot in the namespace of the cluster to restore
+	Name string `json:"name,omitempty" wrangler:"required"`
+	// Changing the generation restores the snapshot again
+	Generation int64 `json:"generation,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type ETCDSnapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ETCDSnapshotSpec `json:"spec"`
+}
+
+type ETCDSnapshotSpec struct {
+	ClusterName  string       `json:"clusterName,omitempty"`
+	SnapshotName string       `json:"snapshotName,omitempty"`
+	NodeName     string       `json:"nodeName,omitempty"`
+	Location     string       `json:"location,omitempty"`
+	CreatedAt    *metav1.Time `json:"createdAt,omitempty"`
+	Size         int64        `json:"size,omitempty"`
+	S3           bool         `json:"s3,omitempty"`
+}
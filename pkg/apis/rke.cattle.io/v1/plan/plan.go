@@ -2,9 +2,13 @@ package plan
 
 import (
 	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
 )
 
+// Version is the format of the plans written by the planner. Version 1 adds gzip compressed file contents.
+const Version = 1
+
 type Plan struct {
 	Nodes    map[string]*Node         `json:"nodes,omitempty"`
 	Machines map[string]*capi.Machine `json:"machines,omitempty"`
@@ -15,11 +19,33 @@ type Node struct {
 	Plan        NodePlan  `json:"plan,omitempty"`
 	AppliedPlan *NodePlan `json:"appliedPlan,omitempty"`
 	InSync      bool      `json:"inSync,omitempty"`
+	// Failures is the number of failed attempts to apply Plan, FailureOutput and FailedAt describe the last one
+	Failures      int          `json:"failures,omitempty"`
+	FailureOutput string       `json:"failureOutput,omitempty"`
+	FailedAt      *metav1.Time `json:"failedAt,omitempty"`
+	// Attempt is the last retry of a failed plan requested by the planner
+	Attempt int `json:"attempt,omitempty"`
+	// ProbeStatus is reported by the agent for the probes of the applied plan, Healthy is true if all pass or the
+	// agent reports no probe statuses
+	ProbeStatus map[string]ProbeStatus `json:"probeStatus,omitempty"`
+	Healthy     bool                   `json:"healthy,omitempty"`
+	// Revision is the cluster plan revision Plan belongs to, History the most recent applied plans
+	Revision int64      `json:"revision,omitempty"`
+	History  []Revision `json:"history,omitempty"`
+}
+
+type Revision struct {
+	Revision int64    `json:"revision,omitempty"`
+	Plan     NodePlan `json:"plan,omitempty"`
 }
 
 type Secret struct {
 	ServerToken string `json:"serverToken,omitempty"`
 	AgentToken  string `json:"agentToken,omitempty"`
+	// PreviousServerToken is set while the join tokens are rotated
+	PreviousServerToken string `json:"previousServerToken,omitempty"`
+	// PlanPublicKeys are the PEM encoded public keys agents accept signed plans from
+	PlanPublicKeys string `json:"planPublicKeys,omitempty"`
 }
 
 type Instruction struct {
@@ -30,14 +56,43 @@ type Instruction struct {
 	Command string   `json:"command,omitempty"`
 }
 
-// Name would be `ca.pem`, Path would be `/etc/kubernetes/ssl`, Contents is base64 encoded
+// Name would be `ca.pem`, Path would be `/etc/kubernetes/ssl`, Contents is base64 encoded. If Compression is gzip
+// Content is compressed before it is encoded.
 type File struct {
-	Content string `json:"content,omitempty"`
-	Name    string `json:"name,omitempty"`
-	Path    string `json:"path,omitempty"`
+	Content     string `json:"content,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Compression string `json:"compression,omitempty"`
 }
 
 type NodePlan struct {
+	// Version of the format of the plan, plans in memory are always decoded and have no version
+	Version      int           `json:"version,omitempty"`
 	Files        []File        `json:"files,omitempty"`
 	Instructions []Instruction `json:"instructions,omitempty"`
+	// Probes are run by the agent once the plan is applied, the machine is only available while all pass
+	Probes map[string]Probe `json:"probes,omitempty"`
+}
+
+type Probe struct {
+	InitialDelaySeconds int           `json:"initialDelaySeconds,omitempty"`
+	TimeoutSeconds      int           `json:"timeoutSeconds,omitempty"`
+	SuccessThreshold    int           `json:"successThreshold,omitempty"`
+	FailureThreshold    int           `json:"failureThreshold,omitempty"`
+	HTTPGetAction       HTTPGetAction `json:"httpGet,omitempty"`
+}
+
+// HTTPGetAction succeeds on a 2xx response, certificates and keys are paths on the machine
+type HTTPGetAction struct {
+	URL        string `json:"url,omitempty"`
+	Insecure   bool   `json:"insecure,omitempty"`
+	ClientCert string `json:"clientCert,omitempty"`
+	ClientKey  string `json:"clientKey,omitempty"`
+	CACert     string `json:"caCert,omitempty"`
+}
+
+type ProbeStatus struct {
+	Healthy      bool `json:"healthy,omitempty"`
+	SuccessCount int  `json:"successCount,omitempty"`
+	FailureCount int  `json:"failureCount,omitempty"`
 }
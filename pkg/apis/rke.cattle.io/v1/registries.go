@@ -0,0 +1,25 @@
+package v1
+
+type Registry struct {
+	// Mirrors of an upstream registry such as docker.io, keyed by the name of the upstream registry
+	Mirrors map[string]Mirror `json:"mirrors,omitempty"`
+	// Configs of the registries, keyed by registry host
+	Configs map[string]RegistryConfig `json:"configs,omitempty"`
+}
+
+type Mirror struct {
+	// Endpoints to pull from, in order, falling back to the upstream registry
+	Endpoints []string `json:"endpoint,omitempty"`
+}
+
+type RegistryConfig struct {
+	// Name of a secret in the namespace of the cluster with the keys username and password, or auth or
+	// identityToken
+	AuthConfigSecretName string `json:"authConfigSecretName,omitempty"`
+	// Name of a kubernetes.io/tls secret in the namespace of the cluster with the client certificate
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+	// PEM encoded CA bundle to verify the registry with
+	CABundle string `json:"caBundle,omitempty"`
+	// Skip verifying the certificate of the registry
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
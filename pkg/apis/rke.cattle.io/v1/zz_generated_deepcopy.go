@@ -30,6 +30,7 @@ import (
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterUpgradeStrategy) DeepCopyInto(out *ClusterUpgradeStrategy) {
 	*out = *in
+	in.DrainOptions.DeepCopyInto(&out.DrainOptions)
 	return
 }
 
@@ -43,6 +44,176 @@ func (in *ClusterUpgradeStrategy) DeepCopy() *ClusterUpgradeStrategy {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DrainOptions) DeepCopyInto(out *DrainOptions) {
+	*out = *in
+	if in.IgnoreDaemonSets != nil {
+		in, out := &in.IgnoreDaemonSets, &out.IgnoreDaemonSets
+		*out = new(bool)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DrainOptions.
+func (in *DrainOptions) DeepCopy() *DrainOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(DrainOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCD) DeepCopyInto(out *ETCD) {
+	*out = *in
+	if in.S3 != nil {
+		in, out := &in.S3, &out.S3
+		*out = new(ETCDSnapshotS3)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCD.
+func (in *ETCD) DeepCopy() *ETCD {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCD)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshot) DeepCopyInto(out *ETCDSnapshot) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshot.
+func (in *ETCDSnapshot) DeepCopy() *ETCDSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ETCDSnapshot) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotCreate) DeepCopyInto(out *ETCDSnapshotCreate) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotCreate.
+func (in *ETCDSnapshotCreate) DeepCopy() *ETCDSnapshotCreate {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotCreate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotList) DeepCopyInto(out *ETCDSnapshotList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ETCDSnapshot, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotList.
+func (in *ETCDSnapshotList) DeepCopy() *ETCDSnapshotList {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ETCDSnapshotList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotRestore) DeepCopyInto(out *ETCDSnapshotRestore) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotRestore.
+func (in *ETCDSnapshotRestore) DeepCopy() *ETCDSnapshotRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotS3) DeepCopyInto(out *ETCDSnapshotS3) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotS3.
+func (in *ETCDSnapshotS3) DeepCopy() *ETCDSnapshotS3 {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotS3)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotSpec) DeepCopyInto(out *ETCDSnapshotSpec) {
+	*out = *in
+	if in.CreatedAt != nil {
+		in, out := &in.CreatedAt, &out.CreatedAt
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotSpec.
+func (in *ETCDSnapshotSpec) DeepCopy() *ETCDSnapshotSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Endpoint) DeepCopyInto(out *Endpoint) {
 	*out = *in
@@ -69,6 +240,59 @@ func (in *GenericMap) DeepCopy() *GenericMap {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Mirror) DeepCopyInto(out *Mirror) {
+	*out = *in
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Mirror.
+func (in *Mirror) DeepCopy() *Mirror {
+	if in == nil {
+		return nil
+	}
+	out := new(Mirror)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlanRevision) DeepCopyInto(out *PlanRevision) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlanRevision.
+func (in *PlanRevision) DeepCopy() *PlanRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(PlanRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlanRollback) DeepCopyInto(out *PlanRollback) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlanRollback.
+func (in *PlanRollback) DeepCopy() *PlanRollback {
+	if in == nil {
+		return nil
+	}
+	out := new(PlanRollback)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RKEBootstrap) DeepCopyInto(out *RKEBootstrap) {
 	*out = *in
@@ -330,7 +554,7 @@ func (in *RKEClusterSpec) DeepCopy() *RKEClusterSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RKEClusterSpecCommon) DeepCopyInto(out *RKEClusterSpecCommon) {
 	*out = *in
-	out.UpgradeStrategy = in.UpgradeStrategy
+	in.UpgradeStrategy.DeepCopyInto(&out.UpgradeStrategy)
 	if in.Config != nil {
 		in, out := &in.Config, &out.Config
 		*out = make([]RKESystemConfig, len(*in))
@@ -338,6 +562,52 @@ func (in *RKEClusterSpecCommon) DeepCopyInto(out *RKEClusterSpecCommon) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ETCD != nil {
+		in, out := &in.ETCD, &out.ETCD
+		*out = new(ETCD)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ETCDSnapshotCreate != nil {
+		in, out := &in.ETCDSnapshotCreate, &out.ETCDSnapshotCreate
+		*out = new(ETCDSnapshotCreate)
+		**out = **in
+	}
+	if in.ETCDSnapshotRestore != nil {
+		in, out := &in.ETCDSnapshotRestore, &out.ETCDSnapshotRestore
+		*out = new(ETCDSnapshotRestore)
+		**out = **in
+	}
+	if in.RotateCertificates != nil {
+		in, out := &in.RotateCertificates, &out.RotateCertificates
+		*out = new(RotateCertificates)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RotateJoinTokens != nil {
+		in, out := &in.RotateJoinTokens, &out.RotateJoinTokens
+		*out = new(RotateJoinTokens)
+		**out = **in
+	}
+	if in.RotateEncryptionKeys != nil {
+		in, out := &in.RotateEncryptionKeys, &out.RotateEncryptionKeys
+		*out = new(RotateEncryptionKeys)
+		**out = **in
+	}
+	if in.RotatePlanSigningKey != nil {
+		in, out := &in.RotatePlanSigningKey, &out.RotatePlanSigningKey
+		*out = new(RotatePlanSigningKey)
+		**out = **in
+	}
+	if in.PlanRollback != nil {
+		in, out := &in.PlanRollback, &out.PlanRollback
+		*out = new(PlanRollback)
+		**out = **in
+	}
+	if in.Registries != nil {
+		in, out := &in.Registries, &out.Registries
+		*out = new(Registry)
+		(*in).DeepCopyInto(*out)
+	}
+	in.ChartValues.DeepCopyInto(&out.ChartValues)
 	return
 }
 
@@ -359,6 +629,25 @@ func (in *RKEClusterStatus) DeepCopyInto(out *RKEClusterStatus) {
 		*out = make([]genericcondition.GenericCondition, len(*in))
 		copy(*out, *in)
 	}
+	if in.ETCDSnapshotRestore != nil {
+		in, out := &in.ETCDSnapshotRestore, &out.ETCDSnapshotRestore
+		*out = new(ETCDSnapshotRestore)
+		**out = **in
+	}
+	if in.InitNodeUnhealthySince != nil {
+		in, out := &in.InitNodeUnhealthySince, &out.InitNodeUnhealthySince
+		*out = (*in).DeepCopy()
+	}
+	if in.PlanRevisions != nil {
+		in, out := &in.PlanRevisions, &out.PlanRevisions
+		*out = make([]PlanRevision, len(*in))
+		copy(*out, *in)
+	}
+	if in.HeldMachines != nil {
+		in, out := &in.HeldMachines, &out.HeldMachines
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -545,6 +834,121 @@ func (in *RKESystemConfig) DeepCopy() *RKESystemConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Registry) DeepCopyInto(out *Registry) {
+	*out = *in
+	if in.Mirrors != nil {
+		in, out := &in.Mirrors, &out.Mirrors
+		*out = make(map[string]Mirror, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.Configs != nil {
+		in, out := &in.Configs, &out.Configs
+		*out = make(map[string]RegistryConfig, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Registry.
+func (in *Registry) DeepCopy() *Registry {
+	if in == nil {
+		return nil
+	}
+	out := new(Registry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegistryConfig) DeepCopyInto(out *RegistryConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryConfig.
+func (in *RegistryConfig) DeepCopy() *RegistryConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RegistryConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RotateCertificates) DeepCopyInto(out *RotateCertificates) {
+	*out = *in
+	if in.Services != nil {
+		in, out := &in.Services, &out.Services
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RotateCertificates.
+func (in *RotateCertificates) DeepCopy() *RotateCertificates {
+	if in == nil {
+		return nil
+	}
+	out := new(RotateCertificates)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RotateEncryptionKeys) DeepCopyInto(out *RotateEncryptionKeys) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RotateEncryptionKeys.
+func (in *RotateEncryptionKeys) DeepCopy() *RotateEncryptionKeys {
+	if in == nil {
+		return nil
+	}
+	out := new(RotateEncryptionKeys)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RotateJoinTokens) DeepCopyInto(out *RotateJoinTokens) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RotateJoinTokens.
+func (in *RotateJoinTokens) DeepCopy() *RotateJoinTokens {
+	if in == nil {
+		return nil
+	}
+	out := new(RotateJoinTokens)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RotatePlanSigningKey) DeepCopyInto(out *RotatePlanSigningKey) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RotatePlanSigningKey.
+func (in *RotatePlanSigningKey) DeepCopy() *RotatePlanSigningKey {
+	if in == nil {
+		return nil
+	}
+	out := new(RotatePlanSigningKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *UnmanagedMachine) DeepCopyInto(out *UnmanagedMachine) {
 	*out = *in
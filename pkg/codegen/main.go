@@ -40,6 +40,8 @@ func main() {
 				Types: []interface{}{
 					capi.Machine{},
 					capi.MachineDeployment{},
+					capi.MachineSet{},
+					capi.MachineHealthCheck{},
 					capi.Cluster{},
 				},
 			},
@@ -11,6 +11,7 @@ import (
 	"github.com/rancher/rancher-operator/pkg/controllers/fleetcluster"
 	"github.com/rancher/rancher-operator/pkg/controllers/projects"
 	cluster2 "github.com/rancher/rancher-operator/pkg/controllers/rke/cluster"
+	"github.com/rancher/rancher-operator/pkg/controllers/rke/etcdsnapshot"
 	"github.com/rancher/rancher-operator/pkg/controllers/rke/machine"
 	machine_provision "github.com/rancher/rancher-operator/pkg/controllers/rke/machine-provision"
 	node_reporter "github.com/rancher/rancher-operator/pkg/controllers/rke/node-reporter"
@@ -53,6 +54,7 @@ func Register(ctx context.Context, capiEnabled, rkeEnabled, crdEnabled bool, cli
 		machine.Register(ctx, clients)
 		machine_provision.Register(ctx, clients)
 		planner.Register(ctx, clients)
+		etcdsnapshot.Register(ctx, clients)
 		node_reporter.Register(ctx, clients)
 		needacert.Register(ctx,
 			clients.Core.Secret(),
@@ -2,47 +2,75 @@ package cluster
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/rancher/lasso/pkg/dynamic"
 	rancherv1 "github.com/rancher/rancher-operator/pkg/apis/rancher.cattle.io/v1"
 	v1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
 	"github.com/rancher/rancher-operator/pkg/clients"
+	capicontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/cluster.x-k8s.io/v1alpha4"
 	mgmtcontroller "github.com/rancher/rancher-operator/pkg/generated/controllers/management.cattle.io/v3"
 	rocontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/rancher.cattle.io/v1"
 	clustercontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/planner"
+	"github.com/rancher/wrangler/pkg/condition"
+	"github.com/rancher/wrangler/pkg/data/convert"
 	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
 	"github.com/rancher/wrangler/pkg/kstatus"
+	"github.com/rancher/wrangler/pkg/name"
+	"github.com/rancher/wrangler/pkg/relatedresource"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
 )
 
 const (
 	byNodeInfra = "by-node-infra"
 )
 
+var (
+	// RKEClusterSynced is false when the spec of the RKECluster differs from the rke config of the rancher cluster
+	RKEClusterSynced = condition.Cond("RKEClusterSynced")
+	// NodePoolsValid is false while the min and max size of a node pool are invalid, the pool is not autoscaled then
+	NodePoolsValid = condition.Cond("NodePoolsValid")
+)
+
 type handler struct {
-	dynamic           *dynamic.Controller
-	dynamicSchema     mgmtcontroller.DynamicSchemaCache
-	clusterClient     clustercontrollers.RKEClusterClient
-	clusterCache      rocontrollers.ClusterCache
-	clusterController rocontrollers.ClusterController
-	secretCache       corecontrollers.SecretCache
-	secretClient      corecontrollers.SecretClient
+	dynamic                *dynamic.Controller
+	dynamicSchema          mgmtcontroller.DynamicSchemaCache
+	clusterClient          clustercontrollers.RKEClusterClient
+	rkeClusterCache        clustercontrollers.RKEClusterCache
+	machineSetCache        capicontrollers.MachineSetCache
+	machineDeploymentCache capicontrollers.MachineDeploymentCache
+	machineDeployments     capicontrollers.MachineDeploymentClient
+	clusterCache           rocontrollers.ClusterCache
+	clusterController      rocontrollers.ClusterController
+	secretCache            corecontrollers.SecretCache
+	secretClient           corecontrollers.SecretClient
 }
 
 func Register(ctx context.Context, clients *clients.Clients) {
 	h := handler{
-		dynamic:           clients.Dynamic,
-		dynamicSchema:     clients.Management.DynamicSchema().Cache(),
-		secretCache:       clients.Core.Secret().Cache(),
-		secretClient:      clients.Core.Secret(),
-		clusterClient:     clients.RKE.RKECluster(),
-		clusterCache:      clients.Cluster.Cluster().Cache(),
-		clusterController: clients.Cluster.Cluster(),
+		dynamic:                clients.Dynamic,
+		dynamicSchema:          clients.Management.DynamicSchema().Cache(),
+		secretCache:            clients.Core.Secret().Cache(),
+		secretClient:           clients.Core.Secret(),
+		clusterClient:          clients.RKE.RKECluster(),
+		rkeClusterCache:        clients.RKE.RKECluster().Cache(),
+		machineSetCache:        clients.CAPI.MachineSet().Cache(),
+		machineDeploymentCache: clients.CAPI.MachineDeployment().Cache(),
+		machineDeployments:     clients.CAPI.MachineDeployment(),
+		clusterCache:           clients.Cluster.Cluster().Cache(),
+		clusterController:      clients.Cluster.Cluster(),
 	}
 
 	clients.RKE.RKECluster().OnChange(ctx, "rke", h.UpdateSpec)
@@ -64,13 +92,28 @@ func Register(ctx context.Context, clients *clients.Clients) {
 			WithCacheTypes(
 				clients.CAPI.Cluster(),
 				clients.CAPI.MachineDeployment(),
+				clients.CAPI.MachineHealthCheck(),
 				clients.RKE.RKECluster(),
 				clients.RKE.RKEBootstrapTemplate(),
-			),
+			).
+			WithPatcher(capi.GroupVersion.WithKind("MachineDeployment"), h.patchMachineDeployment),
 		"",
 		"rke-cluster",
 		h.OnRancherClusterChange,
 		nil)
+
+	relatedresource.Watch(ctx, "rke-cluster-trigger", func(namespace, name string, obj runtime.Object) ([]relatedresource.Key, error) {
+		if machineSet, ok := obj.(*capi.MachineSet); ok {
+			// machine templates are deleted once their MachineSets are scaled down
+			return []relatedresource.Key{{Namespace: namespace, Name: machineSet.Spec.ClusterName}}, nil
+		}
+		if machineDeployment, ok := obj.(*capi.MachineDeployment); ok {
+			// the size of the node pools is reported in the status
+			return []relatedresource.Key{{Namespace: namespace, Name: machineDeployment.Spec.ClusterName}}, nil
+		}
+		// the rancher cluster has the name of its RKECluster
+		return []relatedresource.Key{{Namespace: namespace, Name: name}}, nil
+	}, clients.Cluster.Cluster(), clients.RKE.RKECluster(), clients.CAPI.MachineSet(), clients.CAPI.MachineDeployment())
 }
 
 func byNodeInfraIndex(obj *rancherv1.Cluster) ([]string, error) {
@@ -139,21 +182,35 @@ func (h *handler) UpdateSpec(key string, cluster *v1.RKECluster) (*v1.RKECluster
 		return nil, nil
 	}
 
-	if cluster.Spec.ControlPlaneEndpoint == nil {
+	endpoint := controlPlaneEndpoint(cluster.Spec)
+	if cluster.Spec.ControlPlaneEndpoint == nil || *cluster.Spec.ControlPlaneEndpoint != endpoint {
 		cluster := cluster.DeepCopy()
-		cluster.Spec.ControlPlaneEndpoint = &v1.Endpoint{
-			Host: "localhost",
-			Port: 6443,
-		}
+		cluster.Spec.ControlPlaneEndpoint = &endpoint
 		return h.clusterClient.Update(cluster)
 	}
 
 	return cluster, nil
 }
 
+// controlPlaneEndpoint is the Kubernetes API of the cluster, the registration endpoint if set and localhost otherwise
+func controlPlaneEndpoint(spec v1.RKEClusterSpec) v1.Endpoint {
+	endpoint := v1.Endpoint{
+		Host: "localhost",
+		Port: planner.GetRuntimeAPIServerPort(spec.KubernetesVersion),
+	}
+	if spec.RegistrationEndpoint != "" {
+		endpoint.Host = spec.RegistrationEndpoint
+	}
+	return endpoint
+}
+
+// OnChange reports the readiness computed by the planner
 func (h *handler) OnChange(obj *v1.RKECluster, status v1.RKEClusterStatus) (v1.RKEClusterStatus, error) {
-	status.Ready = true
-	kstatus.SetActive(&status)
+	if status.Ready {
+		kstatus.SetActive(&status)
+	} else {
+		kstatus.SetTransitioning(&status, "waiting for etcd and control plane machines")
+	}
 	return status, nil
 }
 
@@ -161,6 +218,167 @@ func (h *handler) OnRancherClusterChange(obj *rancherv1.Cluster, status rancherv
 	if obj.Spec.RKEConfig == nil || obj.Status.ClusterName == "" {
 		return nil, status, nil
 	}
-	objs, err := objects(obj, h.dynamic, h.dynamicSchema)
+	objs, err := objects(obj, h.dynamic, h.dynamicSchema, h.machineDeploymentCache, h.machineSetCache)
+	if err != nil {
+		return nil, status, err
+	}
+
+	setNodePoolsValid(obj, &status)
+
+	status, err = h.setRKEClusterSynced(obj, status)
+	if err != nil {
+		return nil, status, err
+	}
+
+	status, err = h.mirrorMachineConditions(obj, status)
+	if err != nil {
+		return nil, status, err
+	}
+
+	status, err = h.setNodePoolStatus(obj, status)
 	return objs, status, err
 }
+
+func setNodePoolsValid(obj *rancherv1.Cluster, status *rancherv1.ClusterStatus) {
+	var errs []string
+	for _, nodePool := range obj.Spec.RKEConfig.NodePools {
+		if err := validNodePoolSize(nodePool); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		NodePoolsValid.SetError(status, "", errors.New(strings.Join(errs, ", ")))
+	} else {
+		NodePoolsValid.SetError(status, "", nil)
+	}
+}
+
+// patchMachineDeployment drops the replicas from patches of autoscaled machine deployments, the autoscaler owns them
+// once the machine deployment is created
+func (h *handler) patchMachineDeployment(namespace, name string, pt types.PatchType, data []byte) (runtime.Object, error) {
+	patch := map[string]interface{}{}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, err
+	}
+
+	existing, err := h.machineDeploymentCache.Get(namespace, name)
+	if err != nil && !apierror.IsNotFound(err) {
+		return nil, err
+	}
+	autoscaledDeployment := err == nil && existing.Annotations[autoscalerMinSizeAnnotation] != ""
+	metadata, _ := patch["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if value, ok := annotations[autoscalerMinSizeAnnotation]; ok {
+		// the pool is turned into or out of an autoscaled pool by this patch
+		autoscaledDeployment = value != nil
+	}
+
+	if spec, ok := patch["spec"].(map[string]interface{}); ok && autoscaledDeployment {
+		delete(spec, "replicas")
+		if len(spec) == 0 {
+			delete(patch, "spec")
+		}
+		if data, err = json.Marshal(patch); err != nil {
+			return nil, err
+		}
+	}
+
+	return h.machineDeployments.Patch(namespace, name, pt, data)
+}
+
+// setNodePoolStatus reports the size of the machine deployment of each node pool
+func (h *handler) setNodePoolStatus(obj *rancherv1.Cluster, status rancherv1.ClusterStatus) (rancherv1.ClusterStatus, error) {
+	var nodePools []rancherv1.RKENodePoolStatus
+	for _, nodePool := range obj.Spec.RKEConfig.NodePools {
+		if nodePool.Name == "" {
+			continue
+		}
+
+		nodePoolStatus := rancherv1.RKENodePoolStatus{
+			Name:       nodePool.Name,
+			Autoscaled: autoscaled(nodePool),
+		}
+
+		machineDeployment, err := h.machineDeploymentCache.Get(obj.Namespace, name.SafeConcatName(obj.Name, "nodepool", nodePool.Name))
+		if err != nil && !apierror.IsNotFound(err) {
+			return status, err
+		} else if err == nil {
+			if machineDeployment.Spec.Replicas != nil {
+				nodePoolStatus.Replicas = *machineDeployment.Spec.Replicas
+			}
+			nodePoolStatus.ReadyReplicas = machineDeployment.Status.ReadyReplicas
+		}
+
+		nodePools = append(nodePools, nodePoolStatus)
+	}
+
+	status.NodePools = nodePools
+	return status, nil
+}
+
+// mirrorMachineConditions copies the conditions reporting the machines of the RKECluster to the rancher cluster
+func (h *handler) mirrorMachineConditions(obj *rancherv1.Cluster, status rancherv1.ClusterStatus) (rancherv1.ClusterStatus, error) {
+	existing, err := h.rkeClusterCache.Get(obj.Namespace, obj.Name)
+	if apierror.IsNotFound(err) {
+		return status, nil
+	} else if err != nil {
+		return status, err
+	}
+
+	for _, cond := range planner.MachineConditions {
+		for _, existingCond := range existing.Status.Conditions {
+			if existingCond.Type != string(cond) {
+				continue
+			}
+			cond.SetStatus(&status, string(existingCond.Status))
+			cond.Reason(&status, existingCond.Reason)
+			cond.Message(&status, existingCond.Message)
+		}
+	}
+	return status, nil
+}
+
+// setRKEClusterSynced compares the RKECluster to the one generated from the rancher cluster and reports the fields
+// that differ, such as fields changed on the RKECluster directly
+func (h *handler) setRKEClusterSynced(obj *rancherv1.Cluster, status rancherv1.ClusterStatus) (rancherv1.ClusterStatus, error) {
+	existing, err := h.rkeClusterCache.Get(obj.Namespace, obj.Name)
+	if apierror.IsNotFound(err) {
+		RKEClusterSynced.Unknown(&status)
+		RKEClusterSynced.Message(&status, "waiting for RKECluster to be created")
+		return status, nil
+	} else if err != nil {
+		return status, err
+	}
+
+	desired, err := convert.EncodeToMap(RKECluster(obj).Spec)
+	if err != nil {
+		return status, err
+	}
+	actual, err := convert.EncodeToMap(existing.Spec)
+	if err != nil {
+		return status, err
+	}
+	// set by the RKECluster controller
+	delete(actual, "controlPlaneEndpoint")
+
+	var mismatches []string
+	for key := range desired {
+		if !equality.Semantic.DeepEqual(desired[key], actual[key]) {
+			mismatches = append(mismatches, key)
+		}
+	}
+	for key := range actual {
+		if _, ok := desired[key]; !ok {
+			mismatches = append(mismatches, key)
+		}
+	}
+	sort.Strings(mismatches)
+
+	if len(mismatches) == 0 {
+		RKEClusterSynced.SetError(&status, "", nil)
+	} else {
+		RKEClusterSynced.SetError(&status, "Mismatch", fmt.Errorf("RKECluster %s/%s differs in %s",
+			existing.Namespace, existing.Name, strings.Join(mismatches, ", ")))
+	}
+	return status, nil
+}
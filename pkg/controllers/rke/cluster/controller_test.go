@@ -0,0 +1,135 @@
+package cluster
+
+import (
+	"strings"
+	"testing"
+
+	rancherv1 "github.com/rancher/rancher-operator/pkg/apis/rancher.cattle.io/v1"
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	clustercontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/planner"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/pointer"
+)
+
+type fakeRKEClusterCache struct {
+	clustercontrollers.RKEClusterCache
+	clusters map[string]*rkev1.RKECluster
+}
+
+func (f fakeRKEClusterCache) Get(namespace, name string) (*rkev1.RKECluster, error) {
+	cluster, ok := f.clusters[namespace+"/"+name]
+	if !ok {
+		return nil, apierror.NewNotFound(schema.GroupResource{Group: "rke.cattle.io", Resource: "rkeclusters"}, name)
+	}
+	return cluster, nil
+}
+
+func testRancherCluster() *rancherv1.Cluster {
+	cluster := &rancherv1.Cluster{}
+	cluster.Namespace = "fleet-default"
+	cluster.Name = "test"
+	cluster.Spec.KubernetesVersion = "v1.20.4+k3s1"
+	cluster.Spec.RKEConfig = &rancherv1.RKEConfig{}
+	cluster.Status.ClusterName = "c-test"
+	return cluster
+}
+
+func TestRKEClusterSpecCommon(t *testing.T) {
+	set := rkev1.ClusterUpgradeStrategy{
+		ServerConcurrency: 3,
+		WorkerConcurrency: 10,
+		MaxFailures:       2,
+		DrainOptions: rkev1.DrainOptions{
+			IgnoreDaemonSets: pointer.BoolPtr(false),
+			Timeout:          30,
+		},
+	}
+
+	tests := []struct {
+		name     string
+		strategy rkev1.ClusterUpgradeStrategy
+		want     rkev1.ClusterUpgradeStrategy
+	}{
+		{
+			name: "defaults",
+			want: rkev1.ClusterUpgradeStrategy{
+				ServerConcurrency: 1,
+				WorkerConcurrency: 1,
+				MaxFailures:       planner.DefaultMaxFailures,
+				DrainOptions: rkev1.DrainOptions{
+					IgnoreDaemonSets: pointer.BoolPtr(true),
+					Timeout:          planner.DefaultDrainTimeout,
+				},
+			},
+		},
+		{
+			name:     "values set",
+			strategy: set,
+			want:     set,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := testRancherCluster()
+			cluster.Spec.RKEConfig.UpgradeStrategy = tt.strategy
+
+			got := rkeClusterSpecCommon(cluster)
+			if !equality.Semantic.DeepEqual(got.UpgradeStrategy, tt.want) {
+				t.Errorf("rkeClusterSpecCommon() upgrade strategy = %+v, want %+v", got.UpgradeStrategy, tt.want)
+			}
+			if !equality.Semantic.DeepEqual(cluster.Spec.RKEConfig.UpgradeStrategy, tt.strategy) {
+				t.Errorf("rkeClusterSpecCommon() changed the rancher cluster to %+v", cluster.Spec.RKEConfig.UpgradeStrategy)
+			}
+		})
+	}
+}
+
+func TestSetRKEClusterSynced(t *testing.T) {
+	obj := testRancherCluster()
+	obj.Spec.RKEConfig.AdditionalManifest = "kind: ConfigMap"
+
+	synced := RKECluster(obj)
+	// set by the RKECluster controller and not part of the rke config
+	synced.Spec.ControlPlaneEndpoint = &rkev1.Endpoint{Host: "localhost", Port: 6443}
+
+	changed := RKECluster(obj)
+	changed.Spec.KubernetesVersion = "v1.20.5+k3s1"
+	changed.Spec.AdditionalManifest = ""
+	changed.Spec.SecretsEncryption = true
+
+	tests := []struct {
+		name     string
+		existing *rkev1.RKECluster
+		status   string
+		message  string
+	}{
+		{"not created", nil, "Unknown", "waiting for RKECluster to be created"},
+		{"in sync", synced, "True", ""},
+		{"changed directly", changed, "False", "differs in additionalManifest, kubernetesVersion, secretsEncryption"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := fakeRKEClusterCache{clusters: map[string]*rkev1.RKECluster{}}
+			if tt.existing != nil {
+				cache.clusters[obj.Namespace+"/"+obj.Name] = tt.existing
+			}
+			h := &handler{rkeClusterCache: cache}
+
+			status, err := h.setRKEClusterSynced(obj, rancherv1.ClusterStatus{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := RKEClusterSynced.GetStatus(&status); got != tt.status {
+				t.Errorf("RKEClusterSynced = %q, want %q", got, tt.status)
+			}
+			if got := RKEClusterSynced.GetMessage(&status); !strings.HasSuffix(got, tt.message) {
+				t.Errorf("RKEClusterSynced message = %q, want it to end with %q", got, tt.message)
+			}
+		})
+	}
+}
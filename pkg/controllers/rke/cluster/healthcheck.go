@@ -0,0 +1,161 @@
+package cluster
+
+import (
+	"time"
+
+	rancherv1 "github.com/rancher/rancher-operator/pkg/apis/rancher.cattle.io/v1"
+	capicontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/cluster.x-k8s.io/v1alpha4"
+	"github.com/rancher/wrangler/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+var (
+	defaultUnhealthyConditions = []capi.UnhealthyCondition{
+		{
+			Type:    corev1.NodeReady,
+			Status:  corev1.ConditionFalse,
+			Timeout: metav1.Duration{Duration: 5 * time.Minute},
+		},
+		{
+			Type:    corev1.NodeReady,
+			Status:  corev1.ConditionUnknown,
+			Timeout: metav1.Duration{Duration: 5 * time.Minute},
+		},
+	}
+	defaultNodeStartupTimeout = metav1.Duration{Duration: 10 * time.Minute}
+)
+
+// roleCounts are the number of machines of each role over all node pools of the cluster
+type roleCounts struct {
+	etcd         int
+	controlPlane int
+}
+
+func countRoles(nodePools []rancherv1.RKENodePool, quantities map[string]int) (result roleCounts) {
+	for _, nodePool := range nodePools {
+		quantity := quantities[nodePool.Name]
+		if defaultTrue(nodePool.EtcdRole) {
+			result.etcd += quantity
+		}
+		if defaultTrue(nodePool.ControlPlaneRole) {
+			result.controlPlane += quantity
+		}
+	}
+	return
+}
+
+// quantity is the number of machines of the node pool. Autoscaled pools have the replicas of their machine
+// deployment, current, once it exists.
+func quantity(nodePool rancherv1.RKENodePool, current *int32) int {
+	if autoscaled(nodePool) {
+		if current != nil {
+			return int(*current)
+		}
+		return int(initialReplicas(nodePool))
+	}
+	if nodePool.Quantity == nil {
+		return 1
+	}
+	return int(*nodePool.Quantity)
+}
+
+// nodePoolQuantities returns the quantity of each node pool of the cluster by name
+func nodePoolQuantities(cluster *rancherv1.Cluster, machineDeploymentCache capicontrollers.MachineDeploymentCache) (map[string]int, error) {
+	result := map[string]int{}
+	for _, nodePool := range cluster.Spec.RKEConfig.NodePools {
+		var current *int32
+		if autoscaled(nodePool) {
+			machineDeployment, err := machineDeploymentCache.Get(cluster.Namespace, name.SafeConcatName(cluster.Name, "nodepool", nodePool.Name))
+			if err == nil {
+				current = machineDeployment.Spec.Replicas
+			} else if !apierror.IsNotFound(err) {
+				return nil, err
+			}
+		}
+		result[nodePool.Name] = quantity(nodePool, current)
+	}
+	return result, nil
+}
+
+// machineHealthCheck returns the MachineHealthCheck of the machines of the node pool deployed by machineDeployment
+func machineHealthCheck(machineDeployment *capi.MachineDeployment, nodePool rancherv1.RKENodePool, quantity int, counts roleCounts) (*capi.MachineHealthCheck, error) {
+	config := nodePool.MachineHealthCheck
+	if config == nil {
+		config = &rancherv1.RKEMachinePoolHealthCheck{}
+	}
+
+	mhc := &capi.MachineHealthCheck{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      machineDeployment.Name,
+			Namespace: machineDeployment.Namespace,
+		},
+		Spec: capi.MachineHealthCheckSpec{
+			ClusterName:         machineDeployment.Spec.ClusterName,
+			Selector:            *machineDeployment.Spec.Selector.DeepCopy(),
+			UnhealthyConditions: config.UnhealthyConditions,
+			NodeStartupTimeout:  config.NodeStartupTimeout,
+		},
+	}
+
+	if len(mhc.Spec.UnhealthyConditions) == 0 {
+		mhc.Spec.UnhealthyConditions = defaultUnhealthyConditions
+	}
+	if mhc.Spec.NodeStartupTimeout == nil {
+		mhc.Spec.NodeStartupTimeout = &defaultNodeStartupTimeout
+	}
+
+	maxUnhealthy, err := maxUnhealthy(nodePool, config, quantity, counts)
+	if err != nil {
+		return nil, err
+	}
+	mhc.Spec.MaxUnhealthy = &maxUnhealthy
+
+	return mhc, nil
+}
+
+// maxUnhealthy is the number of unhealthy machines of the node pool that are remediated. Remediation stops while more
+// machines are unhealthy, so 0 turns remediation off. For etcd and control plane pools the machines each pool may
+// remediate are its share of the machines the cluster can lose, so remediating all pools at once keeps etcd quorum and
+// at least one control plane machine.
+func maxUnhealthy(nodePool rancherv1.RKENodePool, config *rancherv1.RKEMachinePoolHealthCheck, quantity int, counts roleCounts) (intstr.IntOrString, error) {
+	if !defaultTrue(config.Remediation) {
+		return intstr.FromInt(0), nil
+	}
+
+	result := quantity
+	if config.MaxUnhealthy != nil {
+		value, err := intstr.GetScaledValueFromIntOrPercent(config.MaxUnhealthy, quantity, false)
+		if err != nil {
+			return intstr.IntOrString{}, err
+		}
+		result = value
+	}
+
+	if defaultTrue(nodePool.EtcdRole) {
+		result = min(result, share((counts.etcd-1)/2, quantity, counts.etcd))
+	}
+	if defaultTrue(nodePool.ControlPlaneRole) {
+		result = min(result, share(counts.controlPlane-1, quantity, counts.controlPlane))
+	}
+
+	return intstr.FromInt(result), nil
+}
+
+// share is the part of the machines the cluster can lose of a pool with quantity of total machines, rounded down
+func share(tolerated, quantity, total int) int {
+	if tolerated <= 0 || total <= 0 {
+		return 0
+	}
+	return tolerated * quantity / total
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,60 @@
+package cluster
+
+import (
+	"testing"
+
+	rancherv1 "github.com/rancher/rancher-operator/pkg/apis/rancher.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+)
+
+func TestMaxUnhealthy(t *testing.T) {
+	worker := rancherv1.RKENodePool{EtcdRole: pointer.BoolPtr(false), ControlPlaneRole: pointer.BoolPtr(false)}
+	percent := intstr.FromString("50%")
+
+	tests := []struct {
+		name     string
+		nodePool rancherv1.RKENodePool
+		config   rancherv1.RKEMachinePoolHealthCheck
+		quantity int
+		counts   roleCounts
+		want     int
+	}{
+		{"remediation off", worker, rancherv1.RKEMachinePoolHealthCheck{Remediation: pointer.BoolPtr(false)}, 3, roleCounts{}, 0},
+		{"workers remediate all machines", worker, rancherv1.RKEMachinePoolHealthCheck{}, 5, roleCounts{}, 5},
+		{"workers with percentage", worker, rancherv1.RKEMachinePoolHealthCheck{MaxUnhealthy: &percent}, 5, roleCounts{}, 2},
+		{"single etcd machine keeps quorum", rancherv1.RKENodePool{}, rancherv1.RKEMachinePoolHealthCheck{}, 1, roleCounts{etcd: 1, controlPlane: 1}, 0},
+		{"three etcd machines tolerate one", rancherv1.RKENodePool{}, rancherv1.RKEMachinePoolHealthCheck{}, 3, roleCounts{etcd: 3, controlPlane: 3}, 1},
+		{"etcd share of several pools", rancherv1.RKENodePool{ControlPlaneRole: pointer.BoolPtr(false)}, rancherv1.RKEMachinePoolHealthCheck{}, 1, roleCounts{etcd: 3, controlPlane: 2}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := maxUnhealthy(tt.nodePool, &tt.config, tt.quantity, tt.counts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.IntValue() != tt.want {
+				t.Errorf("maxUnhealthy() = %d, want %d", got.IntValue(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCountRoles(t *testing.T) {
+	nodePools := []rancherv1.RKENodePool{
+		{Name: "all"},
+		{Name: "etcd", ControlPlaneRole: pointer.BoolPtr(false)},
+		{Name: "worker", EtcdRole: pointer.BoolPtr(false), ControlPlaneRole: pointer.BoolPtr(false)},
+	}
+	quantities := map[string]int{
+		"all":    quantity(nodePools[0], nil),
+		"etcd":   2,
+		"worker": 5,
+	}
+
+	want := roleCounts{etcd: 3, controlPlane: 1}
+	if got := countRoles(nodePools, quantities); got != want {
+		t.Errorf("countRoles() = %+v, want %+v", got, want)
+	}
+}
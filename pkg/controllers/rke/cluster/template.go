@@ -2,14 +2,18 @@ package cluster
 
 import (
 	"encoding/json"
+	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/rancher/lasso/pkg/dynamic"
 	rancherv1 "github.com/rancher/rancher-operator/pkg/apis/rancher.cattle.io/v1"
 	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	capicontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/cluster.x-k8s.io/v1alpha4"
 	mgmtcontroller "github.com/rancher/rancher-operator/pkg/generated/controllers/management.cattle.io/v3"
 	"github.com/rancher/rancher-operator/pkg/planner"
 	"github.com/rancher/rancher-operator/pkg/util"
+	"github.com/rancher/wrangler/pkg/data"
 	"github.com/rancher/wrangler/pkg/data/convert"
 	"github.com/rancher/wrangler/pkg/gvk"
 	"github.com/rancher/wrangler/pkg/name"
@@ -17,19 +21,26 @@ import (
 	apierror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
 )
 
-func objects(cluster *rancherv1.Cluster, dynamic *dynamic.Controller, dynamicSchema mgmtcontroller.DynamicSchemaCache) (result []runtime.Object, _ error) {
-	rkeCluster := rkeCluster(cluster)
+const (
+	autoscalerMinSizeAnnotation = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size"
+	autoscalerMaxSizeAnnotation = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size"
+)
+
+func objects(cluster *rancherv1.Cluster, dynamic *dynamic.Controller, dynamicSchema mgmtcontroller.DynamicSchemaCache,
+	machineDeploymentCache capicontrollers.MachineDeploymentCache, machineSetCache capicontrollers.MachineSetCache) (result []runtime.Object, _ error) {
+	rkeCluster := RKECluster(cluster)
 	result = append(result, rkeCluster)
 
 	capiCluster := capiCluster(cluster, rkeCluster)
 	result = append(result, capiCluster)
 
-	machineDeployments, err := machineDeployments(cluster, capiCluster, dynamic, dynamicSchema)
+	machineDeployments, err := machineDeployments(cluster, capiCluster, dynamic, dynamicSchema, machineDeploymentCache, machineSetCache)
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +49,16 @@ func objects(cluster *rancherv1.Cluster, dynamic *dynamic.Controller, dynamicSch
 	return result, nil
 }
 
+// objectFields describe the node config object rather than the machines, they are never part of a machine template
+var objectFields = []string{"apiVersion", "kind", "metadata", "status"}
+
+// pruneBySchema drops the fields of the node config that are not in its dynamic schema. Without a schema only the
+// object fields are dropped, so the machine template and its hash only cover the config of the machines.
 func pruneBySchema(kind string, data map[string]interface{}, dynamicSchema mgmtcontroller.DynamicSchemaCache) error {
+	for _, field := range objectFields {
+		delete(data, field)
+	}
+
 	ds, err := dynamicSchema.Get(strings.ToLower(kind))
 	if apierror.IsNotFound(err) {
 		return nil
@@ -56,7 +76,7 @@ func pruneBySchema(kind string, data map[string]interface{}, dynamicSchema mgmtc
 }
 
 func toMachineTemplate(nodePoolName string, cluster *rancherv1.Cluster, nodePool rancherv1.RKENodePool,
-	dynamic *dynamic.Controller, dynamicSchema mgmtcontroller.DynamicSchemaCache) (runtime.Object, error) {
+	dynamic *dynamic.Controller, dynamicSchema mgmtcontroller.DynamicSchemaCache) (*unstructured.Unstructured, error) {
 	apiVersion := nodePool.NodeConfig.APIVersion
 	kind := nodePool.NodeConfig.Kind
 	if apiVersion == "" {
@@ -78,32 +98,114 @@ func toMachineTemplate(nodePoolName string, cluster *rancherv1.Cluster, nodePool
 		return nil, err
 	}
 
-	commonData, err := convert.EncodeToMap(nodePool.RKECommonNodeConfig)
+	return machineTemplate(nodePoolName, cluster.Namespace, kind, nodePoolData, nodePool.RKECommonNodeConfig)
+}
+
+// machineTemplate returns the machine template of the node config of a pool. The name changes with the node config,
+// so changing it rolls the machines of the pool. The common config is left out of the name: the labels and taints
+// reach the machines through the template annotations of the machine deployment, the hostname prefix only names new
+// machines.
+func machineTemplate(nodePoolName, namespace, kind string, nodePoolData data.Object, common rkev1.RKECommonNodeConfig) (*unstructured.Unstructured, error) {
+	content, err := json.Marshal(nodePoolData)
+	if err != nil {
+		return nil, err
+	}
+
+	commonData, err := convert.EncodeToMap(common)
 	if err != nil {
 		return nil, err
 	}
 
-	nodePoolData.Set("common", commonData)
+	spec := data.Object{}
+	for k, v := range nodePoolData {
+		spec[k] = v
+	}
+	spec.Set("common", commonData)
 
 	return &unstructured.Unstructured{
 		Object: map[string]interface{}{
 			"kind":       strings.TrimSuffix(kind, "Config") + "MachineTemplate",
 			"apiVersion": "rke-node.cattle.io/v1",
 			"metadata": map[string]interface{}{
-				"name":      nodePoolName,
-				"namespace": cluster.Namespace,
+				"name":      name.SafeConcatName(nodePoolName, name.Hex(string(content), 8)),
+				"namespace": namespace,
 			},
 			"spec": map[string]interface{}{
 				"template": map[string]interface{}{
-					"spec": map[string]interface{}(nodePoolData),
+					"spec": map[string]interface{}(spec),
 				},
 			},
 		},
 	}, nil
 }
 
+// machineTemplatesInUse returns the machine templates of the MachineSets of the machine deployment that still have
+// machines, other than the current template. They are kept until the rollout to the current template finished, then
+// they are no longer applied and are deleted.
+func machineTemplatesInUse(namespace, machineDeploymentName, current string, dynamic *dynamic.Controller,
+	machineSetCache capicontrollers.MachineSetCache) (result []runtime.Object, _ error) {
+	machineSets, err := machineSetCache.List(namespace, labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{
+		current: true,
+	}
+	for _, machineSet := range machineSets {
+		if !ownedBy(machineSet, machineDeploymentName) {
+			continue
+		}
+		if (machineSet.Spec.Replicas == nil || *machineSet.Spec.Replicas == 0) && machineSet.Status.Replicas == 0 {
+			continue
+		}
+
+		ref := machineSet.Spec.Template.Spec.InfrastructureRef
+		if seen[ref.Name] {
+			continue
+		}
+		seen[ref.Name] = true
+
+		template, err := dynamic.Get(schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind), namespace, ref.Name)
+		if apierror.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		data, err := util.ToMap(template.DeepCopyObject())
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"kind":       ref.Kind,
+				"apiVersion": ref.APIVersion,
+				"metadata": map[string]interface{}{
+					"name":      ref.Name,
+					"namespace": namespace,
+				},
+				"spec": data["spec"],
+			},
+		})
+	}
+
+	return result, nil
+}
+
+func ownedBy(machineSet *capi.MachineSet, machineDeploymentName string) bool {
+	for _, owner := range machineSet.OwnerReferences {
+		if owner.Kind == "MachineDeployment" && owner.Name == machineDeploymentName {
+			return true
+		}
+	}
+	return false
+}
+
 func machineDeployments(cluster *rancherv1.Cluster, capiCluster *capi.Cluster, dynamic *dynamic.Controller,
-	dynamicSchema mgmtcontroller.DynamicSchemaCache) (result []runtime.Object, _ error) {
+	dynamicSchema mgmtcontroller.DynamicSchemaCache, machineDeploymentCache capicontrollers.MachineDeploymentCache,
+	machineSetCache capicontrollers.MachineSetCache) (result []runtime.Object, _ error) {
 	bootstrapName := name.SafeConcatName(cluster.Name, "bootstrap", "template")
 
 	if len(cluster.Spec.RKEConfig.NodePools) > 0 {
@@ -115,6 +217,12 @@ func machineDeployments(cluster *rancherv1.Cluster, capiCluster *capi.Cluster, d
 		})
 	}
 
+	quantities, err := nodePoolQuantities(cluster, machineDeploymentCache)
+	if err != nil {
+		return nil, err
+	}
+	counts := countRoles(cluster.Spec.RKEConfig.NodePools, quantities)
+
 	for _, nodePool := range cluster.Spec.RKEConfig.NodePools {
 		if nodePool.Name == "" || nodePool.NodeConfig == nil || nodePool.NodeConfig.Name == "" || nodePool.NodeConfig.Kind == "" {
 			continue
@@ -129,17 +237,36 @@ func machineDeployments(cluster *rancherv1.Cluster, capiCluster *capi.Cluster, d
 
 		result = append(result, machineTemplate)
 
+		inUse, err := machineTemplatesInUse(cluster.Namespace, nodePoolName, machineTemplate.GetName(), dynamic, machineSetCache)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, inUse...)
+
+		replicas, err := replicas(cluster.Namespace, nodePoolName, nodePool, machineDeploymentCache)
+		if err != nil {
+			return nil, err
+		}
+
 		machineDeployment := &capi.MachineDeployment{
 			ObjectMeta: metav1.ObjectMeta{
-				Namespace: cluster.Namespace,
-				Name:      nodePoolName,
+				Namespace:   cluster.Namespace,
+				Name:        nodePoolName,
+				Annotations: map[string]string{},
 			},
 			Spec: capi.MachineDeploymentSpec{
 				ClusterName: capiCluster.Name,
-				Replicas:    nodePool.Quantity,
+				Replicas:    replicas,
+				Selector: metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						capi.MachineDeploymentLabelName: nodePoolName,
+					},
+				},
 				Template: capi.MachineTemplateSpec{
 					ObjectMeta: capi.ObjectMeta{
-						Labels:      map[string]string{},
+						Labels: map[string]string{
+							capi.MachineDeploymentLabelName: nodePoolName,
+						},
 						Annotations: map[string]string{},
 					},
 					Spec: capi.MachineSpec{
@@ -155,7 +282,7 @@ func machineDeployments(cluster *rancherv1.Cluster, capiCluster *capi.Cluster, d
 						InfrastructureRef: corev1.ObjectReference{
 							Kind:       machineTemplate.GetObjectKind().GroupVersionKind().Kind,
 							Namespace:  cluster.Namespace,
-							Name:       nodePoolName,
+							Name:       machineTemplate.GetName(),
 							APIVersion: "rke-node.cattle.io/v1",
 						},
 					},
@@ -173,6 +300,11 @@ func machineDeployments(cluster *rancherv1.Cluster, capiCluster *capi.Cluster, d
 			}
 		}
 
+		if autoscaled(nodePool) {
+			machineDeployment.Annotations[autoscalerMinSizeAnnotation] = strconv.Itoa(int(*nodePool.MinSize))
+			machineDeployment.Annotations[autoscalerMaxSizeAnnotation] = strconv.Itoa(int(*nodePool.MaxSize))
+		}
+
 		if defaultTrue(nodePool.EtcdRole) {
 			machineDeployment.Spec.Template.Labels[planner.EtcdRoleLabel] = "true"
 		}
@@ -195,11 +327,66 @@ func machineDeployments(cluster *rancherv1.Cluster, capiCluster *capi.Cluster, d
 		}
 
 		result = append(result, machineDeployment)
+
+		mhc, err := machineHealthCheck(machineDeployment, nodePool, quantities[nodePool.Name], counts)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, mhc)
 	}
 
 	return result, nil
 }
 
+// autoscaled is true if the size of the pool is handed to the cluster autoscaler, see validNodePoolSize
+func autoscaled(nodePool rancherv1.RKENodePool) bool {
+	return nodePool.MinSize != nil && nodePool.MaxSize != nil && *nodePool.MinSize <= *nodePool.MaxSize
+}
+
+// validNodePoolSize returns an error if only one of the min and max size of the pool is set or the min size exceeds
+// the max size. Such pools are not autoscaled.
+func validNodePoolSize(nodePool rancherv1.RKENodePool) error {
+	switch {
+	case nodePool.MinSize == nil && nodePool.MaxSize == nil:
+		return nil
+	case nodePool.MinSize == nil || nodePool.MaxSize == nil:
+		return fmt.Errorf("node pool %s: minSize and maxSize must be set together", nodePool.Name)
+	case *nodePool.MinSize > *nodePool.MaxSize:
+		return fmt.Errorf("node pool %s: minSize %d exceeds maxSize %d", nodePool.Name, *nodePool.MinSize, *nodePool.MaxSize)
+	}
+	return nil
+}
+
+// replicas returns the quantity of the node pool. Autoscaled pools are created with the quantity kept within the min
+// and max size, after that the autoscaler owns the replicas and none are returned, see patchMachineDeployment.
+func replicas(namespace, machineDeploymentName string, nodePool rancherv1.RKENodePool,
+	machineDeploymentCache capicontrollers.MachineDeploymentCache) (*int32, error) {
+	if !autoscaled(nodePool) {
+		return nodePool.Quantity, nil
+	}
+
+	if _, err := machineDeploymentCache.Get(namespace, machineDeploymentName); err == nil {
+		return nil, nil
+	} else if !apierror.IsNotFound(err) {
+		return nil, err
+	}
+
+	replicas := initialReplicas(nodePool)
+	return &replicas, nil
+}
+
+// initialReplicas is the quantity of an autoscaled node pool kept within its min and max size
+func initialReplicas(nodePool rancherv1.RKENodePool) int32 {
+	replicas := *nodePool.MinSize
+	if nodePool.Quantity != nil && *nodePool.Quantity > replicas {
+		replicas = *nodePool.Quantity
+	}
+	if replicas > *nodePool.MaxSize {
+		replicas = *nodePool.MaxSize
+	}
+	return replicas
+}
+
 func defaultTrue(b *bool) bool {
 	if b == nil {
 		return true
@@ -216,7 +403,8 @@ func assign(labels map[string]string, key string, value interface{}) error {
 	return nil
 }
 
-func rkeCluster(cluster *rancherv1.Cluster) *rkev1.RKECluster {
+// RKECluster returns the RKECluster provisioned for the rancher cluster
+func RKECluster(cluster *rancherv1.Cluster) *rkev1.RKECluster {
 	return &rkev1.RKECluster{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      cluster.Name,
@@ -224,15 +412,37 @@ func rkeCluster(cluster *rancherv1.Cluster) *rkev1.RKECluster {
 		},
 		Spec: rkev1.RKEClusterSpec{
 			CloudCredentialSecretName: cluster.Spec.CloudCredentialSecretName,
-			RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
-				UpgradeStrategy: rkev1.ClusterUpgradeStrategy{},
-			},
-			KubernetesVersion:     cluster.Spec.KubernetesVersion,
-			ManagementClusterName: cluster.Status.ClusterName,
+			RKEClusterSpecCommon:      rkeClusterSpecCommon(cluster),
+			KubernetesVersion:         cluster.Spec.KubernetesVersion,
+			ManagementClusterName:     cluster.Status.ClusterName,
 		},
 	}
 }
 
+// rkeClusterSpecCommon copies the rke config of the cluster and fills in the defaults of the planner
+func rkeClusterSpecCommon(cluster *rancherv1.Cluster) rkev1.RKEClusterSpecCommon {
+	spec := *cluster.Spec.RKEConfig.RKEClusterSpecCommon.DeepCopy()
+
+	if spec.UpgradeStrategy.ServerConcurrency == 0 {
+		spec.UpgradeStrategy.ServerConcurrency = 1
+	}
+	if spec.UpgradeStrategy.WorkerConcurrency == 0 {
+		spec.UpgradeStrategy.WorkerConcurrency = 1
+	}
+	if spec.UpgradeStrategy.MaxFailures == 0 {
+		spec.UpgradeStrategy.MaxFailures = planner.DefaultMaxFailures
+	}
+	if spec.UpgradeStrategy.DrainOptions.IgnoreDaemonSets == nil {
+		ignoreDaemonSets := true
+		spec.UpgradeStrategy.DrainOptions.IgnoreDaemonSets = &ignoreDaemonSets
+	}
+	if spec.UpgradeStrategy.DrainOptions.Timeout == 0 {
+		spec.UpgradeStrategy.DrainOptions.Timeout = planner.DefaultDrainTimeout
+	}
+
+	return spec
+}
+
 func capiCluster(cluster *rancherv1.Cluster, rkeCluster *rkev1.RKECluster) *capi.Cluster {
 	gvk, err := gvk.Get(rkeCluster)
 	if err != nil {
@@ -241,6 +451,9 @@ func capiCluster(cluster *rancherv1.Cluster, rkeCluster *rkev1.RKECluster) *capi
 	}
 
 	apiVersion, kind := gvk.ToAPIVersionAndKind()
+	// CAPI only copies the endpoint of the RKECluster while the endpoint of the cluster is unset, changes of the
+	// registration endpoint are applied here
+	endpoint := controlPlaneEndpoint(rkeCluster.Spec)
 
 	return &capi.Cluster{
 		ObjectMeta: metav1.ObjectMeta{
@@ -248,6 +461,10 @@ func capiCluster(cluster *rancherv1.Cluster, rkeCluster *rkev1.RKECluster) *capi
 			Namespace: cluster.Namespace,
 		},
 		Spec: capi.ClusterSpec{
+			ControlPlaneEndpoint: capi.APIEndpoint{
+				Host: endpoint.Host,
+				Port: int32(endpoint.Port),
+			},
 			InfrastructureRef: &corev1.ObjectReference{
 				Kind:       kind,
 				Namespace:  rkeCluster.Namespace,
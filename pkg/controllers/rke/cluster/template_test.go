@@ -0,0 +1,90 @@
+package cluster
+
+import (
+	"testing"
+
+	rancherv1 "github.com/rancher/rancher-operator/pkg/apis/rancher.cattle.io/v1"
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/wrangler/pkg/data"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestValidNodePoolSize(t *testing.T) {
+	for name, nodePool := range map[string]rancherv1.RKENodePool{
+		"only min size":             {MinSize: pointer.Int32Ptr(1)},
+		"only max size":             {MaxSize: pointer.Int32Ptr(1)},
+		"min size exceeds max size": {MinSize: pointer.Int32Ptr(3), MaxSize: pointer.Int32Ptr(1)},
+	} {
+		if validNodePoolSize(nodePool) == nil || autoscaled(nodePool) {
+			t.Errorf("%s: node pool is valid and autoscaled", name)
+		}
+	}
+
+	fixed := rancherv1.RKENodePool{MinSize: pointer.Int32Ptr(2), MaxSize: pointer.Int32Ptr(2)}
+	if err := validNodePoolSize(fixed); err != nil || !autoscaled(fixed) {
+		t.Errorf("node pool with equal sizes is not autoscaled: %v", err)
+	}
+}
+
+func TestAutoscaledQuantity(t *testing.T) {
+	nodePool := rancherv1.RKENodePool{MinSize: pointer.Int32Ptr(2), MaxSize: pointer.Int32Ptr(5)}
+
+	tests := []struct {
+		quantity *int32
+		current  *int32
+		want     int
+	}{
+		{nil, nil, 2},
+		{pointer.Int32Ptr(3), nil, 3},
+		{pointer.Int32Ptr(1), nil, 2},
+		{pointer.Int32Ptr(9), nil, 5},
+		// the autoscaler owns the replicas once the machine deployment exists
+		{pointer.Int32Ptr(3), pointer.Int32Ptr(4), 4},
+	}
+
+	for _, tt := range tests {
+		nodePool.Quantity = tt.quantity
+		if got := quantity(nodePool, tt.current); got != tt.want {
+			t.Errorf("quantity() of quantity %d, current %d = %d, want %d", pointer.Int32PtrDerefOr(tt.quantity, 0), pointer.Int32PtrDerefOr(tt.current, 0), got, tt.want)
+		}
+	}
+}
+
+func TestMachineTemplate(t *testing.T) {
+	nodeConfig := data.Object{"instanceType": "t3.medium"}
+	common := rkev1.RKECommonNodeConfig{HostnamePrefix: "node-"}
+
+	template, err := machineTemplate("test-nodepool-pool", "fleet-default", "AmazonEC2Config", nodeConfig, common)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.GetKind() != "AmazonEC2MachineTemplate" {
+		t.Errorf("machine template kind = %s, want AmazonEC2MachineTemplate", template.GetKind())
+	}
+	if prefix := data.Object(template.Object).String("spec", "template", "spec", "common", "hostnamePrefix"); prefix != "node-" {
+		t.Errorf("machine template has hostname prefix %q, want node-", prefix)
+	}
+
+	// labels, taints and the hostname prefix do not replace the machines
+	common = rkev1.RKECommonNodeConfig{
+		HostnamePrefix: "other-",
+		Labels:         map[string]string{"role": "db"},
+		Taints:         []corev1.Taint{{Key: "db", Effect: corev1.TaintEffectNoSchedule}},
+	}
+	changed, err := machineTemplate("test-nodepool-pool", "fleet-default", "AmazonEC2Config", nodeConfig, common)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.GetName() != template.GetName() {
+		t.Errorf("changing the common config renamed the machine template from %s to %s", template.GetName(), changed.GetName())
+	}
+
+	changed, err = machineTemplate("test-nodepool-pool", "fleet-default", "AmazonEC2Config", data.Object{"instanceType": "t3.large"}, common)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.GetName() == template.GetName() {
+		t.Errorf("changing the node config kept the machine template %s", template.GetName())
+	}
+}
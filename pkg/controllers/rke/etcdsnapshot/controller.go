@@ -0,0 +1,121 @@
+package etcdsnapshot
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/clients"
+	rkecontroller "github.com/rancher/rancher-operator/pkg/generated/controllers/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/kubeconfig"
+	"github.com/rancher/rancher-operator/pkg/planner"
+	"github.com/rancher/wrangler/pkg/apply"
+	"github.com/rancher/wrangler/pkg/name"
+	"github.com/sirupsen/logrus"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	syncInterval = 5 * time.Minute
+)
+
+// snapshotFile is the format the runtime uses to record snapshots in the <runtime>-etcd-snapshots ConfigMap
+type snapshotFile struct {
+	Name      string          `json:"name,omitempty"`
+	Location  string          `json:"location,omitempty"`
+	NodeName  string          `json:"nodeName,omitempty"`
+	CreatedAt *metav1.Time    `json:"createdAt,omitempty"`
+	Size      int64           `json:"size,omitempty"`
+	S3        json.RawMessage `json:"s3,omitempty"`
+}
+
+type handler struct {
+	ctx         context.Context
+	rkeClusters rkecontroller.RKEClusterController
+	kubeconfig  *kubeconfig.Manager
+	apply       apply.Apply
+}
+
+func Register(ctx context.Context, clients *clients.Clients) {
+	h := handler{
+		ctx:         ctx,
+		rkeClusters: clients.RKE.RKECluster(),
+		kubeconfig:  kubeconfig.New(clients),
+		apply: clients.Apply.
+			WithSetID("etcd-snapshot").
+			WithCacheTypes(clients.RKE.ETCDSnapshot()),
+	}
+	clients.RKE.RKECluster().OnChange(ctx, "etcd-snapshot", h.OnChange)
+}
+
+func (h *handler) OnChange(key string, cluster *rkev1.RKECluster) (*rkev1.RKECluster, error) {
+	if cluster == nil || cluster.DeletionTimestamp != nil {
+		return cluster, nil
+	}
+
+	snapshots, err := h.listSnapshots(cluster)
+	if apierror.IsNotFound(err) {
+		// the cluster is not reachable yet
+		return cluster, nil
+	} else if err != nil {
+		return cluster, err
+	}
+
+	h.rkeClusters.EnqueueAfter(cluster.Namespace, cluster.Name, syncInterval)
+	return cluster, h.apply.WithOwner(cluster).ApplyObjects(snapshots...)
+}
+
+func (h *handler) listSnapshots(cluster *rkev1.RKECluster) ([]runtime.Object, error) {
+	k8s, err := h.kubeconfig.GetClient(cluster.Namespace, cluster.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// clusters without a version in the spec run the default version of the catalog, which the status records
+	kubernetesVersion := cluster.Status.KubernetesVersion
+	if kubernetesVersion == "" {
+		kubernetesVersion = cluster.Spec.KubernetesVersion
+	}
+
+	configMapName := planner.GetRuntime(kubernetesVersion) + "-etcd-snapshots"
+	configMap, err := k8s.CoreV1().ConfigMaps("kube-system").Get(h.ctx, configMapName, metav1.GetOptions{})
+	if apierror.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var result []runtime.Object
+	for key, value := range configMap.Data {
+		file := snapshotFile{}
+		if err := json.Unmarshal([]byte(value), &file); err != nil {
+			logrus.Errorf("invalid etcd snapshot %s in cluster %s/%s: %v", key, cluster.Namespace, cluster.Name, err)
+			continue
+		}
+		if file.Name == "" {
+			file.Name = key
+		}
+
+		result = append(result, &rkev1.ETCDSnapshot{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name.SafeConcatName(cluster.Name, strings.ToLower(key)),
+				Namespace: cluster.Namespace,
+			},
+			Spec: rkev1.ETCDSnapshotSpec{
+				ClusterName:  cluster.Name,
+				SnapshotName: file.Name,
+				NodeName:     file.NodeName,
+				Location:     file.Location,
+				CreatedAt:    file.CreatedAt,
+				Size:         file.Size,
+				S3:           len(file.S3) > 0 && string(file.S3) != "null",
+			},
+		})
+	}
+
+	return result, nil
+}
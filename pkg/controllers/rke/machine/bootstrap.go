@@ -10,7 +10,9 @@ import (
 	"github.com/rancher/rancher-operator/pkg/settings"
 )
 
-func Bootstrap(settingsCache mgmtcontroller.SettingCache, token string) ([]byte, error) {
+// Bootstrap returns the script installing the agent, planPublicKeys are the PEM encoded keys the agent accepts
+// signed plans from
+func Bootstrap(settingsCache mgmtcontroller.SettingCache, token, planPublicKeys string) ([]byte, error) {
 	url, err := settings.Get(settingsCache, "agent-install-script")
 	if err != nil {
 		return nil, err
@@ -37,7 +39,8 @@ func Bootstrap(settingsCache mgmtcontroller.SettingCache, token string) ([]byte,
 CATTLE_SERVER="%s"
 CATTLE_CA_CHECKSUM="%s"
 CATTLE_TOKEN="%s"
+CATTLE_PLAN_PUBLIC_KEYS="%s"
 
 %s
-`, url, ca, token, script)), nil
+`, url, ca, token, planPublicKeys, script)), nil
 }
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"sync"
 
 	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
 	"github.com/rancher/rancher-operator/pkg/clients"
@@ -19,6 +20,7 @@ import (
 	rbacv1 "k8s.io/api/rbac/v1"
 	apierror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
@@ -40,19 +42,25 @@ var (
 type handler struct {
 	serviceAccountCache corecontrollers.ServiceAccountCache
 	secretCache         corecontrollers.SecretCache
+	secretClient        corecontrollers.SecretClient
 	clusterCache        capicontrollers.ClusterCache
 	machines            capicontrollers.MachineClient
+	machineCache        capicontrollers.MachineCache
 	settingsCache       mgmtcontrollers.SettingCache
 	rkeBootstrapCache   rkecontroller.RKEBootstrapCache
 	rkeBootstrap        rkecontroller.RKEBootstrapClient
+	// planPublicKeysSeen holds the plan public keys last seen in each state secret
+	planPublicKeysSeen sync.Map
 }
 
 func Register(ctx context.Context, clients *clients.Clients) {
 	h := &handler{
 		serviceAccountCache: clients.Core.ServiceAccount().Cache(),
 		secretCache:         clients.Core.Secret().Cache(),
+		secretClient:        clients.Core.Secret(),
 		clusterCache:        clients.CAPI.Cluster().Cache(),
 		machines:            clients.CAPI.Machine(),
+		machineCache:        clients.CAPI.Machine().Cache(),
 		settingsCache:       clients.Management.Setting().Cache(),
 		rkeBootstrapCache:   clients.RKE.RKEBootstrap().Cache(),
 		rkeBootstrap:        clients.RKE.RKEBootstrap(),
@@ -72,7 +80,7 @@ func Register(ctx context.Context, clients *clients.Clients) {
 		h.OnChange,
 		nil)
 
-	relatedresource.Watch(ctx, "rke-machine-trigger", func(namespace, name string, obj runtime.Object) ([]relatedresource.Key, error) {
+	relatedresource.Watch(ctx, "rke-machine-trigger", func(namespace, _ string, obj runtime.Object) ([]relatedresource.Key, error) {
 		if sa, ok := obj.(*corev1.ServiceAccount); ok {
 			if name, ok := sa.Labels[machineNameLabel]; ok {
 				return []relatedresource.Key{
@@ -83,8 +91,42 @@ func Register(ctx context.Context, clients *clients.Clients) {
 				}, nil
 			}
 		}
+		if secret, ok := obj.(*corev1.Secret); ok && secret.Type == "rke.cattle.io/cluster-state" {
+			return h.planPublicKeysChanged(secret)
+		}
 		return nil, nil
-	}, clients.CAPI.Machine(), clients.Core.ServiceAccount())
+	}, clients.CAPI.Machine(), clients.Core.ServiceAccount(), clients.Core.Secret())
+}
+
+// planPublicKeysChanged returns the machines of the cluster of the state secret if the plan public keys in it
+// changed, their bootstrap secrets carry the keys. Other changes to the state secret, such as rotated join tokens,
+// do not concern the bootstrap secrets.
+func (h *handler) planPublicKeysChanged(secret *corev1.Secret) ([]relatedresource.Key, error) {
+	planPublicKeys, err := planner.PlanPublicKeys(secret.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	key := secret.Namespace + "/" + secret.Name
+	if previous, ok := h.planPublicKeysSeen.Load(key); ok && previous == planPublicKeys {
+		return nil, nil
+	}
+	h.planPublicKeysSeen.Store(key, planPublicKeys)
+
+	machines, err := h.machineCache.List(secret.Namespace, labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var result []relatedresource.Key
+	for _, machine := range machines {
+		if name.SafeConcatName(machine.Spec.ClusterName, "rke", "state") == secret.Name {
+			result = append(result, relatedresource.Key{
+				Namespace: machine.Namespace,
+				Name:      machine.Name,
+			})
+		}
+	}
+	return result, nil
 }
 
 func IsRKECluster(spec *capi.ClusterSpec) bool {
@@ -96,7 +138,17 @@ func IsRKECluster(spec *capi.ClusterSpec) bool {
 		spec.InfrastructureRef.Kind == "RKECluster"
 }
 
-func (h *handler) getBootstrapSecret(namespace, name string) (*corev1.Secret, error) {
+// planPublicKeys returns the public keys machines verify their plans with, the signing key is generated if the
+// planner did not get to it yet
+func (h *handler) planPublicKeys(namespace, clusterName string) (string, error) {
+	secret, err := planner.EnsureStateSecret(h.secretCache, h.secretClient, namespace, clusterName)
+	if err != nil {
+		return "", err
+	}
+	return planner.PlanPublicKeys(secret.Data)
+}
+
+func (h *handler) getBootstrapSecret(namespace, name, clusterName string) (*corev1.Secret, error) {
 	sa, err := h.serviceAccountCache.Get(namespace, name)
 	if apierror.IsNotFound(err) {
 		return nil, nil
@@ -106,6 +158,11 @@ func (h *handler) getBootstrapSecret(namespace, name string) (*corev1.Secret, er
 		return nil, err
 
 	}
+
+	planPublicKeys, err := h.planPublicKeys(namespace, clusterName)
+	if err != nil {
+		return nil, err
+	}
 	for _, secretRef := range sa.Secrets {
 		secret, err := h.secretCache.Get(sa.Namespace, secretRef.Name)
 		if err != nil {
@@ -113,7 +170,7 @@ func (h *handler) getBootstrapSecret(namespace, name string) (*corev1.Secret, er
 		}
 
 		hash := sha256.Sum256(secret.Data["token"])
-		data, err := Bootstrap(h.settingsCache, base64.URLEncoding.EncodeToString(hash[:]))
+		data, err := Bootstrap(h.settingsCache, base64.URLEncoding.EncodeToString(hash[:]), planPublicKeys)
 		if err != nil {
 			return nil, err
 		}
@@ -221,7 +278,7 @@ func (h *handler) assignBootStrapSecret(obj *capi.Machine) (*corev1.Secret, []ru
 		},
 	}
 
-	bootstrapSecret, err := h.getBootstrapSecret(sa.Namespace, sa.Name)
+	bootstrapSecret, err := h.getBootstrapSecret(sa.Namespace, sa.Name, obj.Spec.ClusterName)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/rancher/lasso/pkg/dynamic"
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
 	"github.com/rancher/rancher-operator/pkg/clients"
 	capicontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/cluster.x-k8s.io/v1alpha4"
 	rkecontroller "github.com/rancher/rancher-operator/pkg/generated/controllers/rke.cattle.io/v1"
@@ -64,19 +65,19 @@ func (h *handler) OnChange(key string, node *v3.Node) (*v3.Node, error) {
 	}
 
 	for _, machine := range machines {
-		if ok, err := h.sameCluster(node, machine); apierror.IsNotFound(err) {
+		if rkeCluster, err := h.getRKECluster(node, machine); apierror.IsNotFound(err) {
 			return node, nil
 		} else if err != nil {
 			return node, err
-		} else if ok {
-			return node, h.updateMachine(node, machine)
+		} else if rkeCluster != nil {
+			return node, h.updateMachine(node, machine, rkeCluster)
 		}
 	}
 
 	return node, nil
 }
 
-func (h *handler) updateMachineJoinURL(node *v3.Node, machine *capi.Machine) error {
+func (h *handler) updateMachineJoinURL(node *v3.Node, machine *capi.Machine, rkeCluster *rkev1.RKECluster) error {
 	address := ""
 	for _, nodeAddress := range node.Status.InternalNodeStatus.Addresses {
 		switch nodeAddress.Type {
@@ -89,7 +90,13 @@ func (h *handler) updateMachineJoinURL(node *v3.Node, machine *capi.Machine) err
 		}
 	}
 
-	url := fmt.Sprintf("https://%s:6443", address)
+	// the kubelet version names the runtime the node runs, also for clusters running the default version of the catalog
+	kubernetesVersion := node.Status.InternalNodeStatus.NodeInfo.KubeletVersion
+	if kubernetesVersion == "" {
+		kubernetesVersion = rkeCluster.Spec.KubernetesVersion
+	}
+
+	url := fmt.Sprintf("https://%s:%d", address, planner.GetRuntimeSupervisorPort(kubernetesVersion))
 	if machine.Annotations[planner.JoinURLAnnotation] == url {
 		return nil
 	}
@@ -104,8 +111,8 @@ func (h *handler) updateMachineJoinURL(node *v3.Node, machine *capi.Machine) err
 	return err
 }
 
-func (h *handler) updateMachine(node *v3.Node, machine *capi.Machine) error {
-	if err := h.updateMachineJoinURL(node, machine); err != nil {
+func (h *handler) updateMachine(node *v3.Node, machine *capi.Machine, rkeCluster *rkev1.RKECluster) error {
+	if err := h.updateMachineJoinURL(node, machine, rkeCluster); err != nil {
 		return err
 	}
 
@@ -138,22 +145,26 @@ func (h *handler) updateMachine(node *v3.Node, machine *capi.Machine) error {
 	return nil
 }
 
-func (h *handler) sameCluster(node *v3.Node, machine *capi.Machine) (bool, error) {
+// getRKECluster returns the RKECluster of the machine if the node belongs to that cluster, nil otherwise
+func (h *handler) getRKECluster(node *v3.Node, machine *capi.Machine) (*rkev1.RKECluster, error) {
 	capiCluster, err := h.capiClusterCache.Get(machine.Namespace, machine.Spec.ClusterName)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	if capiCluster.Spec.InfrastructureRef == nil ||
 		capiCluster.Spec.InfrastructureRef.APIVersion != "rke.cattle.io/v1" ||
 		capiCluster.Spec.InfrastructureRef.Kind != "RKECluster" {
-		return false, nil
+		return nil, nil
 	}
 
 	rkeCluster, err := h.rkeClusterCache.Get(machine.Namespace, capiCluster.Spec.InfrastructureRef.Name)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	return rkeCluster.Spec.ManagementClusterName == node.Namespace, nil
+	if rkeCluster.Spec.ManagementClusterName != node.Namespace {
+		return nil, nil
+	}
+	return rkeCluster, nil
 }
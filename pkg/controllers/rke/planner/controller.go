@@ -7,23 +7,46 @@ import (
 	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
 	"github.com/rancher/rancher-operator/pkg/clients"
 	"github.com/rancher/rancher-operator/pkg/controllers/rke/machine"
+	capicontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/cluster.x-k8s.io/v1alpha4"
+	rocontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/rancher.cattle.io/v1"
 	v1 "github.com/rancher/rancher-operator/pkg/generated/controllers/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/namespaces"
 	"github.com/rancher/rancher-operator/pkg/planner"
+	"github.com/rancher/rancher-operator/pkg/versions"
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	"github.com/rancher/wrangler/pkg/relatedresource"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
 )
 
+const byReferencedSecret = "by-referenced-secret"
+
 type handler struct {
-	planner *planner.Planner
+	planner         *planner.Planner
+	rkeClusterCache v1.RKEClusterCache
+	clusterCache    rocontrollers.ClusterCache
+	machineCache    capicontrollers.MachineCache
 }
 
 func Register(ctx context.Context, clients *clients.Clients) {
 	h := handler{
-		planner: planner.New(ctx, clients),
+		planner:         planner.New(ctx, clients),
+		rkeClusterCache: clients.RKE.RKECluster().Cache(),
+		clusterCache:    clients.Cluster.Cluster().Cache(),
+		machineCache:    clients.CAPI.Machine().Cache(),
 	}
+	clients.RKE.RKECluster().Cache().AddIndexer(byReferencedSecret, func(obj *rkev1.RKECluster) ([]string, error) {
+		var result []string
+		for _, name := range planner.ReferencedSecrets(obj) {
+			result = append(result, obj.Namespace+"/"+name)
+		}
+		return result, nil
+	})
+
 	v1.RegisterRKEClusterStatusHandler(ctx,
 		clients.RKE.RKECluster(), "", "planner", h.OnChange)
 	relatedresource.Watch(ctx, "planner", func(namespace, name string, obj runtime.Object) ([]relatedresource.Key, error) {
@@ -35,6 +58,7 @@ func Register(ctx context.Context, clients *clients.Clients) {
 					Name:      clusterName,
 				}}, nil
 			}
+			return h.referencingClusters(secret)
 		} else if machine, ok := obj.(*capi.Machine); ok {
 			return []relatedresource.Key{{
 				Namespace: machine.Namespace,
@@ -43,6 +67,104 @@ func Register(ctx context.Context, clients *clients.Clients) {
 		}
 		return nil, nil
 	}, clients.RKE.RKECluster(), clients.Core.Secret(), clients.CAPI.Machine())
+	relatedresource.Watch(ctx, "planner-versions", h.versionsWatch,
+		clients.RKE.RKECluster(), clients.Core.ConfigMap(), clients.Management.Setting())
+
+	rocontrollers.RegisterClusterGeneratingHandler(ctx,
+		clients.Cluster.Cluster(),
+		clients.Apply.
+			WithSetID("planner-preview").
+			WithSetOwnerReference(true, false).
+			WithCacheTypes(clients.Core.ConfigMap()),
+		"",
+		"planner-preview",
+		h.OnPreview,
+		nil)
+	relatedresource.Watch(ctx, "planner-preview", h.previewWatch,
+		clients.Cluster.Cluster(), clients.Core.Secret(), clients.CAPI.Machine())
+}
+
+// referencingClusters returns the clusters rendering the secret, such as registry credentials, into their plans
+func (h *handler) referencingClusters(secret *corev1.Secret) ([]relatedresource.Key, error) {
+	clusters, err := h.rkeClusterCache.GetByIndex(byReferencedSecret, secret.Namespace+"/"+secret.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []relatedresource.Key
+	for _, cluster := range clusters {
+		result = append(result, relatedresource.Key{
+			Namespace: cluster.Namespace,
+			Name:      cluster.Name,
+		})
+	}
+	return result, nil
+}
+
+func (h *handler) versionsWatch(namespace, name string, obj runtime.Object) ([]relatedresource.Key, error) {
+	switch obj := obj.(type) {
+	case *corev1.ConfigMap:
+		if obj.Namespace != namespaces.System || obj.Name != versions.ConfigMapName {
+			return nil, nil
+		}
+	case *v3.Setting:
+		if obj.Name != versions.SettingName && obj.Name != versions.SystemDefaultRegistrySetting {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	clusters, err := h.rkeClusterCache.List("", labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	var result []relatedresource.Key
+	for _, cluster := range clusters {
+		result = append(result, relatedresource.Key{
+			Namespace: cluster.Namespace,
+			Name:      cluster.Name,
+		})
+	}
+	return result, nil
+}
+
+// previewWatch recomputes the preview of a cluster when the plan secrets or the machines of the cluster change
+func (h *handler) previewWatch(namespace, name string, obj runtime.Object) ([]relatedresource.Key, error) {
+	clusterName := ""
+	switch obj := obj.(type) {
+	case *corev1.Secret:
+		if obj.Type != "rke.cattle.io/machine-plan" || obj.Labels[planner.MachineNameLabel] == "" {
+			return nil, nil
+		}
+		machine, err := h.machineCache.Get(obj.Namespace, obj.Labels[planner.MachineNameLabel])
+		if apierror.IsNotFound(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		clusterName = machine.Spec.ClusterName
+	case *capi.Machine:
+		clusterName = obj.Spec.ClusterName
+	default:
+		return nil, nil
+	}
+
+	cluster, err := h.clusterCache.Get(namespace, clusterName)
+	if apierror.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if _, ok := cluster.Annotations[PreviewAnnotation]; !ok {
+		return nil, nil
+	}
+
+	return []relatedresource.Key{{
+		Namespace: cluster.Namespace,
+		Name:      cluster.Name,
+	}}, nil
 }
 
 func (h *handler) OnChange(cluster *rkev1.RKECluster, status rkev1.RKEClusterStatus) (rkev1.RKEClusterStatus, error) {
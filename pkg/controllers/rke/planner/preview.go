@@ -0,0 +1,102 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	rancherv1 "github.com/rancher/rancher-operator/pkg/apis/rancher.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/controllers/rke/cluster"
+	v1 "github.com/rancher/rancher-operator/pkg/generated/controllers/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/planner"
+	"github.com/rancher/rancher-operator/pkg/versions"
+	"github.com/rancher/wrangler/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// PreviewAnnotation on a rancher cluster holds a proposed cluster spec, as YAML or JSON, whose plans are previewed
+// in the ConfigMap <cluster>-plan-preview. An empty value previews the current spec.
+const PreviewAnnotation = "rke.cattle.io/plan-preview"
+
+var errInvalidPreview = errors.New("invalid preview")
+
+// Preview compares the current plans of the machines of the cluster to the plans they would get if the spec of the
+// cluster was replaced by spec. A nil spec previews the current spec.
+func Preview(p *planner.Planner, rkeClusterCache v1.RKEClusterCache, rancherCluster *rancherv1.Cluster, spec *rancherv1.ClusterSpec) (*planner.ClusterPreview, error) {
+	rancherCluster = rancherCluster.DeepCopy()
+	if spec != nil {
+		rancherCluster.Spec = *spec
+	}
+	if rancherCluster.Spec.RKEConfig == nil {
+		return nil, fmt.Errorf("%w: cluster %s/%s has no rkeConfig", errInvalidPreview, rancherCluster.Namespace, rancherCluster.Name)
+	}
+
+	rkeCluster, err := rkeClusterCache.Get(rancherCluster.Namespace, rancherCluster.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	rkeCluster = rkeCluster.DeepCopy()
+	rkeCluster.Spec = cluster.RKECluster(rancherCluster).Spec
+	return p.Preview(rkeCluster)
+}
+
+// ParsePreviewSpec reads a proposed cluster spec from YAML or JSON, both a full cluster and only its spec are accepted
+func ParsePreviewSpec(data string) (*rancherv1.ClusterSpec, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	obj := &rancherv1.Cluster{}
+	if err := yaml.NewYAMLOrJSONDecoder(strings.NewReader(data), 4096).Decode(obj); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPreview, err)
+	}
+	if obj.Kind != "" {
+		return &obj.Spec, nil
+	}
+
+	spec := &rancherv1.ClusterSpec{}
+	if err := yaml.NewYAMLOrJSONDecoder(strings.NewReader(data), 4096).Decode(spec); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPreview, err)
+	}
+	return spec, nil
+}
+
+func (h *handler) OnPreview(obj *rancherv1.Cluster, status rancherv1.ClusterStatus) ([]runtime.Object, rancherv1.ClusterStatus, error) {
+	value, ok := obj.Annotations[PreviewAnnotation]
+	if !ok || obj.Spec.RKEConfig == nil {
+		return nil, status, nil
+	}
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.SafeConcatName(obj.Name, "plan", "preview"),
+			Namespace: obj.Namespace,
+		},
+		Data: map[string]string{},
+	}
+
+	spec, err := ParsePreviewSpec(value)
+	if err == nil {
+		var preview *planner.ClusterPreview
+		preview, err = Preview(h.planner, h.rkeClusterCache, obj, spec)
+		if err == nil {
+			configMap.Data["preview"] = planner.FormatPreview(preview)
+		}
+	}
+
+	// problems with the proposed spec are reported to the user instead of being retried
+	if errors.Is(err, errInvalidPreview) || errors.Is(err, versions.ErrUnknownVersion) ||
+		errors.Is(err, versions.ErrInvalidCatalog) {
+		configMap.Data = map[string]string{
+			"error": err.Error(),
+		}
+	} else if err != nil {
+		return nil, status, err
+	}
+
+	return []runtime.Object{configMap}, status, nil
+}
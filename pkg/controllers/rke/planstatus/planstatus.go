@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 
 	"github.com/rancher/rancher-operator/pkg/clients"
+	"github.com/rancher/rancher-operator/pkg/planner"
 	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
 	corev1 "k8s.io/api/core/v1"
 )
@@ -34,7 +35,9 @@ func (h *handler) OnChange(key string, secret *corev1.Secret) (*corev1.Secret, e
 	if appliedChecksum == hash(plan) {
 		if !bytes.Equal(plan, appliedPlan) {
 			secret = secret.DeepCopy()
-			secret.Data["appliedPlan"] = plan
+			if err := planner.RecordAppliedPlan(secret); err != nil {
+				return secret, err
+			}
 			return h.secrets.Update(secret)
 		}
 	}
@@ -71,6 +71,13 @@ func operator() []crd.CRD {
 			}
 			return c
 		}),
+		newRKECRD(&rkev1.ETCDSnapshot{}, func(c crd.CRD) crd.CRD {
+			return c.
+				WithColumn("Cluster", ".spec.clusterName").
+				WithColumn("Node", ".spec.nodeName").
+				WithColumn("Location", ".spec.location").
+				WithColumn("Created", ".spec.createdAt")
+		}),
 		newRKECRD(&rkev1.UnmanagedMachine{}, func(c crd.CRD) crd.CRD {
 			c.Labels = map[string]string{
 				"cluster.x-k8s.io/v1alpha4": "v1",
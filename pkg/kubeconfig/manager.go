@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"strings"
+	"sync"
 
 	v1 "github.com/rancher/rancher-operator/pkg/apis/rancher.cattle.io/v1"
 	"github.com/rancher/rancher-operator/pkg/clients"
@@ -19,6 +20,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
@@ -42,6 +44,15 @@ type Manager struct {
 	secretCache     corecontrollers.SecretCache
 	secrets         corecontrollers.SecretClient
 	settings        mgmtcontrollers.SettingCache
+
+	clientLock sync.Mutex
+	clients    map[string]cachedClient
+}
+
+// cachedClient is a client of a cluster built from the given revision of its kubeconfig secret
+type cachedClient struct {
+	resourceVersion string
+	client          kubernetes.Interface
 }
 
 func New(clients *clients.Clients) *Manager {
@@ -54,6 +65,7 @@ func New(clients *clients.Clients) *Manager {
 		secretCache:     clients.Core.Secret().Cache(),
 		secrets:         clients.Core.Secret(),
 		settings:        clients.Management.Setting().Cache(),
+		clients:         map[string]cachedClient{},
 	}
 }
 
@@ -256,6 +268,37 @@ func (m *Manager) GetKubeConfig(cluster *v1.Cluster, status v1.ClusterStatus) (*
 	}, nil
 }
 
+// GetClient returns a client of the cluster, it is reused until the kubeconfig secret of the cluster changes. A
+// NotFound error is returned until the secret is created.
+func (m *Manager) GetClient(clusterNamespace, clusterName string) (kubernetes.Interface, error) {
+	secret, err := m.secretCache.Get(clusterNamespace, GetKubeConfigSecretName(clusterName))
+	if err != nil {
+		return nil, err
+	}
+
+	key := clusterNamespace + "/" + clusterName
+	m.clientLock.Lock()
+	defer m.clientLock.Unlock()
+	if cached, ok := m.clients[key]; ok && cached.resourceVersion == secret.ResourceVersion {
+		return cached.client, nil
+	}
+
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(secret.Data["value"])
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	m.clients[key] = cachedClient{
+		resourceVersion: secret.ResourceVersion,
+		client:          client,
+	}
+	return client, nil
+}
+
 func (m *Manager) GetServerURLAndCA() (string, string, error) {
 	serverURL, ca, err := settings.GetServerURLAndCA(m.settings)
 	if err != nil {
@@ -3,4 +3,5 @@ package namespaces
 const (
 	GlobalData          = "cattle-global-data"
 	GlobalNodeTemplates = "cattle-global-nt"
+	System              = "cattle-system"
 )
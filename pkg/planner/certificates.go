@@ -0,0 +1,67 @@
+package planner
+
+import (
+	"fmt"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+// rotateCertificatesInstruction rotates the certificates of a machine once its plan is applied. The generation is
+// part of the name so changing it produces a new plan that is rolled out like any other change. The instruction is
+// only part of the plans while the rotation is pending, machines joining later get certificates of their own.
+func rotateCertificatesInstruction(cluster *rkev1.RKECluster, machine *capi.Machine) *plan.Instruction {
+	if !rotatingCertificates(cluster) {
+		return nil
+	}
+	rotate := cluster.Spec.RotateCertificates
+
+	var (
+		runtime = GetRuntime(cluster.Spec.KubernetesVersion)
+		script  string
+	)
+
+	if isOnlyWorker(machine) {
+		// agent certificates are issued by the servers each time the agent starts
+		script = fmt.Sprintf("systemctl restart %s", GetRuntimeAgentUnit(cluster.Spec.KubernetesVersion))
+	} else {
+		args := "certificate rotate"
+		for _, service := range rotate.Services {
+			args += " --service=" + service
+		}
+		unit := GetRuntimeServerUnit(cluster.Spec.KubernetesVersion)
+		script = fmt.Sprintf("systemctl stop %s && %s %s && systemctl start %s", unit, runtime, args, unit)
+	}
+
+	return &plan.Instruction{
+		Name:    fmt.Sprintf("rotate-certificates-%d", rotate.Generation),
+		Command: "sh",
+		Args:    []string{"-c", script},
+	}
+}
+
+func rotatingCertificates(cluster *rkev1.RKECluster) bool {
+	return cluster.Spec.RotateCertificates != nil &&
+		cluster.Spec.RotateCertificates.Generation != cluster.Status.CertificateRotationGeneration
+}
+
+// setCertificateRotationProgress records which machines are rotating their certificates while a rotation is pending
+func setCertificateRotationProgress(cluster *rkev1.RKECluster, stage string) {
+	if !rotatingCertificates(cluster) {
+		return
+	}
+	CertificatesRotated.Unknown(&cluster.Status)
+	CertificatesRotated.Reason(&cluster.Status, "Rotating")
+	CertificatesRotated.Message(&cluster.Status, fmt.Sprintf("rotating certificates of %s machines", stage))
+}
+
+// finishCertificateRotation records the rotation once every machine is in sync, machines joining later are not given
+// the rotate instruction anymore
+func finishCertificateRotation(cluster *rkev1.RKECluster) {
+	if !rotatingCertificates(cluster) {
+		return
+	}
+	cluster.Status.CertificateRotationGeneration = cluster.Spec.RotateCertificates.Generation
+	CertificatesRotated.SetError(&cluster.Status, "", nil)
+}
@@ -0,0 +1,30 @@
+package planner
+
+import (
+	"testing"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+)
+
+func TestProcessCertificateRotation(t *testing.T) {
+	planner := newTestPlanner(t)
+	cluster := testCluster()
+	planner.addMachine(cluster, "machine-1", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+	planner.process(t, cluster)
+
+	cluster.Spec.RotateCertificates = &rkev1.RotateCertificates{Generation: 1}
+	planner.process(t, cluster)
+	if cluster.Status.CertificateRotationGeneration != 1 || !CertificatesRotated.IsTrue(&cluster.Status) {
+		t.Fatalf("certificate rotation of a cluster without worker-only machines did not finish: %+v", cluster.Status)
+	}
+	if !hasInstruction(planner.plan(t, "machine-1"), "rotate-certificates-1") {
+		t.Error("machine-1 did not rotate its certificates")
+	}
+
+	// machines joining after the rotation get certificates of their own
+	planner.addMachine(cluster, "machine-2", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+	planner.process(t, cluster)
+	if hasInstruction(planner.plan(t, "machine-2"), "rotate-certificates-") {
+		t.Error("machine joining after the rotation rotates its certificates")
+	}
+}
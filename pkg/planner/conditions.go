@@ -0,0 +1,38 @@
+package planner
+
+import (
+	"github.com/rancher/wrangler/pkg/condition"
+)
+
+var (
+	// KubernetesVersionValid is false when the Kubernetes version of the cluster can not be provisioned
+	KubernetesVersionValid = condition.Cond("KubernetesVersionValid")
+	// CertificatesRotated is unknown while a certificate rotation is rolled out
+	CertificatesRotated = condition.Cond("CertificatesRotated")
+	// JoinTokensRotated is unknown while new join tokens are rolled out
+	JoinTokensRotated = condition.Cond("JoinTokensRotated")
+	// PlanSigningKeyRotated is unknown while the machines are given the public key of a new plan signing key
+	PlanSigningKeyRotated = condition.Cond("PlanSigningKeyRotated")
+	// EncryptionKeysPrepared, EncryptionKeysRotated and SecretsReencrypted report the phases of a secrets encryption
+	// key rotation, each is unknown until its phase completed
+	EncryptionKeysPrepared = condition.Cond("EncryptionKeysPrepared")
+	EncryptionKeysRotated  = condition.Cond("EncryptionKeysRotated")
+	SecretsReencrypted     = condition.Cond("SecretsReencrypted")
+	// KubernetesVersionUpgraded is unknown while the machines are upgraded to a new Kubernetes version, other
+	// version changes are rejected until it is true
+	KubernetesVersionUpgraded = condition.Cond("KubernetesVersionUpgraded")
+	// RolloutPaused is true while the cluster is paused or machines are held, no new plans are written to them
+	RolloutPaused = condition.Cond("RolloutPaused")
+	// PlanSizeValid is false when the plan of a machine does not fit into its plan secret
+	PlanSizeValid = condition.Cond("PlanSizeValid")
+	// Provisioned, Updated, EtcdHealthy and ControlPlaneReady report the machines of the cluster with their counts
+	Provisioned       = condition.Cond("Provisioned")
+	Updated           = condition.Cond("Updated")
+	EtcdHealthy       = condition.Cond("EtcdHealthy")
+	ControlPlaneReady = condition.Cond("ControlPlaneReady")
+	// PlansApplied is false when a machine failed to apply its plan too often and the rollout is halted
+	PlansApplied = condition.Cond("PlansApplied")
+
+	// MachineConditions are mirrored from the RKECluster to its rancher cluster
+	MachineConditions = []condition.Cond{Provisioned, Updated, EtcdHealthy, ControlPlaneReady}
+)
@@ -0,0 +1,55 @@
+package planner
+
+import (
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/versions"
+	"github.com/rancher/wrangler/pkg/data"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+// plannerConfigKeys are always computed by the planner, values for them in RKESystemConfig are ignored. The keys
+// node-taint, tls-san, secrets-encryption, disable-apiserver, disable-controller-manager, disable-scheduler,
+// disable-etcd and the etcd-snapshot and etcd-s3 keys are set from the machine and the cluster spec when those
+// configure them, and then override the values of RKESystemConfig.
+var plannerConfigKeys = []string{
+	"agent-token",
+	"cluster-init",
+	"node-label",
+	"server",
+	"token",
+}
+
+// machineConfig merges the default config of the Kubernetes version and every RKESystemConfig matching the
+// machine, in order. Nested maps are merged, all other values are replaced by later entries.
+func machineConfig(cluster *rkev1.RKECluster, version *versions.Version, machine *capi.Machine) (map[string]interface{}, error) {
+	config := data.MergeMaps(nil, version.DefaultConfig)
+	for _, opts := range cluster.Spec.Config {
+		ok, err := configMatches(opts, machine)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			config = data.MergeMaps(config, opts.Config.DeepCopy().Data)
+		}
+	}
+	return config, nil
+}
+
+// configMatches is true if the machine has the name and the labels the config selects. As before machine names were
+// supported, a config without a selector matches no machine unless it names one, an empty selector matches all.
+func configMatches(opts rkev1.RKESystemConfig, machine *capi.Machine) (bool, error) {
+	if opts.MachineName != "" && opts.MachineName != machine.Name {
+		return false, nil
+	}
+	if opts.MachineLabelSelector == nil {
+		return opts.MachineName != "", nil
+	}
+
+	sel, err := metav1.LabelSelectorAsSelector(opts.MachineLabelSelector)
+	if err != nil {
+		return false, err
+	}
+	return sel.Matches(labels.Set(machine.Labels)), nil
+}
@@ -0,0 +1,130 @@
+package planner
+
+import (
+	"testing"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/versions"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+func testMachine(name string, labels map[string]string) *capi.Machine {
+	return &capi.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+	}
+}
+
+func TestConfigMatches(t *testing.T) {
+	machine := testMachine("machine-1", map[string]string{"role": "server"})
+
+	tests := []struct {
+		name string
+		opts rkev1.RKESystemConfig
+		want bool
+	}{
+		{"no selector", rkev1.RKESystemConfig{}, false},
+		{"empty selector", rkev1.RKESystemConfig{MachineLabelSelector: &metav1.LabelSelector{}}, true},
+		{"machine name", rkev1.RKESystemConfig{MachineName: "machine-1"}, true},
+		{"other machine name", rkev1.RKESystemConfig{MachineName: "machine-2"}, false},
+		{"matching labels", rkev1.RKESystemConfig{MachineLabelSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"role": "server"},
+		}}, true},
+		{"other labels", rkev1.RKESystemConfig{MachineLabelSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"role": "agent"},
+		}}, false},
+		{"machine name and other labels", rkev1.RKESystemConfig{
+			MachineName: "machine-1",
+			MachineLabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"role": "agent"},
+			},
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := configMatches(tt.opts, machine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("configMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMachineConfig(t *testing.T) {
+	all := &metav1.LabelSelector{}
+	version := &versions.Version{
+		DefaultConfig: map[string]interface{}{
+			"write-kubeconfig-mode": "0600",
+			"kubelet-arg":           []interface{}{"max-pods=110"},
+			"etcd-snapshot":         map[string]interface{}{"retention": 5},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		config []rkev1.RKESystemConfig
+		want   map[string]interface{}
+	}{
+		{
+			name:   "defaults",
+			config: nil,
+			want:   version.DefaultConfig,
+		},
+		{
+			name: "later entries replace values",
+			config: []rkev1.RKESystemConfig{
+				{MachineLabelSelector: all, Config: rkev1.GenericMap{Data: map[string]interface{}{"write-kubeconfig-mode": "0644"}}},
+				{MachineName: "machine-1", Config: rkev1.GenericMap{Data: map[string]interface{}{"kubelet-arg": []interface{}{"max-pods=200"}}}},
+			},
+			want: map[string]interface{}{
+				"write-kubeconfig-mode": "0644",
+				"kubelet-arg":           []interface{}{"max-pods=200"},
+				"etcd-snapshot":         map[string]interface{}{"retention": 5},
+			},
+		},
+		{
+			name: "nested maps are merged",
+			config: []rkev1.RKESystemConfig{
+				{MachineLabelSelector: all, Config: rkev1.GenericMap{Data: map[string]interface{}{
+					"etcd-snapshot": map[string]interface{}{"schedule": "0 * * * *"},
+				}}},
+			},
+			want: map[string]interface{}{
+				"write-kubeconfig-mode": "0600",
+				"kubelet-arg":           []interface{}{"max-pods=110"},
+				"etcd-snapshot":         map[string]interface{}{"retention": 5, "schedule": "0 * * * *"},
+			},
+		},
+		{
+			name: "other machines are skipped",
+			config: []rkev1.RKESystemConfig{
+				{MachineName: "machine-2", Config: rkev1.GenericMap{Data: map[string]interface{}{"write-kubeconfig-mode": "0644"}}},
+				{Config: rkev1.GenericMap{Data: map[string]interface{}{"write-kubeconfig-mode": "0640"}}},
+			},
+			want: version.DefaultConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &rkev1.RKECluster{}
+			cluster.Spec.Config = tt.config
+
+			got, err := machineConfig(cluster, version, testMachine("machine-1", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equality.Semantic.DeepEqual(got, tt.want) {
+				t.Errorf("machineConfig() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package planner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/kubectl/pkg/drain"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+const (
+	// DrainedAnnotation is set on a machine once its node is cordoned and drained for the plan with the given hash.
+	// The node is uncordoned and the annotation removed once the machine is in sync with that plan.
+	DrainedAnnotation = "rke.cattle.io/drained"
+
+	// MachineDrained is the condition of a machine reporting the drain of its node before a new plan is applied
+	MachineDrained capi.ConditionType = "Drained"
+
+	// DefaultDrainTimeout is the number of seconds a drain may take before it is retried
+	DefaultDrainTimeout = 120
+)
+
+var drainRetryDelay = 30 * time.Second
+
+func planHash(nodePlan plan.NodePlan) (string, error) {
+	data, err := json.Marshal(nodePlan)
+	if err != nil {
+		return "", err
+	}
+	return checksum(data), nil
+}
+
+func shouldDrain(cluster *rkev1.RKECluster, machine *capi.Machine) bool {
+	if machine.Status.NodeRef == nil {
+		return false
+	}
+	if isOnlyWorker(machine) {
+		return cluster.Spec.UpgradeStrategy.DrainWorkerNodes
+	}
+	return cluster.Spec.UpgradeStrategy.DrainServerNodes
+}
+
+// drain cordons and drains the node of the machine before the given plan is applied and returns true once done.
+// Draining runs in the background as it can take a long time; the cluster is enqueued again when it finishes.
+func (p *Planner) drain(cluster *rkev1.RKECluster, entry planEntry, desired plan.NodePlan) (bool, error) {
+	if !shouldDrain(cluster, entry.Machine) {
+		return true, nil
+	}
+
+	hash, err := planHash(desired)
+	if err != nil {
+		return false, err
+	}
+	if entry.Machine.Annotations[DrainedAnnotation] == hash {
+		return true, nil
+	}
+
+	key := drainKey(entry.Machine, hash)
+	p.drainLock.Lock()
+	defer p.drainLock.Unlock()
+	if p.draining[key] {
+		return false, nil
+	}
+	p.draining[key] = true
+
+	if err := p.setMachineDrainCondition(entry.Machine, corev1.ConditionUnknown, "Draining",
+		fmt.Sprintf("draining node %s", entry.Machine.Status.NodeRef.Name)); err != nil {
+		delete(p.draining, key)
+		return false, err
+	}
+
+	go func() {
+		defer func() {
+			p.drainLock.Lock()
+			delete(p.draining, key)
+			p.drainLock.Unlock()
+		}()
+
+		err := p.drainNode(cluster, entry.Machine, hash)
+		if err == nil {
+			err = p.setMachineDrainCondition(entry.Machine, corev1.ConditionTrue, "", "")
+		} else {
+			logrus.Errorf("failed to drain node %s of machine %s/%s, retrying in %s: %v",
+				entry.Machine.Status.NodeRef.Name, entry.Machine.Namespace, entry.Machine.Name, drainRetryDelay, err)
+			err = p.setMachineDrainCondition(entry.Machine, corev1.ConditionFalse, "DrainFailed",
+				fmt.Sprintf("failed to drain node %s, retrying in %s: %v", entry.Machine.Status.NodeRef.Name, drainRetryDelay, err))
+			p.rkeClusters.EnqueueAfter(cluster.Namespace, cluster.Name, drainRetryDelay)
+		}
+		if err != nil {
+			logrus.Errorf("failed to report the drain of machine %s/%s: %v", entry.Machine.Namespace, entry.Machine.Name, err)
+		}
+	}()
+
+	return false, nil
+}
+
+func (p *Planner) drainNode(cluster *rkev1.RKECluster, machine *capi.Machine, hash string) error {
+	helper, err := p.drainHelper(cluster)
+	if err != nil {
+		return err
+	}
+
+	node, err := helper.Client.CoreV1().Nodes().Get(p.ctx, machine.Status.NodeRef.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if err := drain.RunCordonOrUncordon(helper, node, true); err != nil {
+		return err
+	}
+
+	if err := drain.RunNodeDrain(helper, node.Name); err != nil {
+		return err
+	}
+
+	return p.setDrainedAnnotation(machine, hash)
+}
+
+// undrain uncordons the node of a machine drained by the planner once the machine is in sync with its plan
+func (p *Planner) undrain(cluster *rkev1.RKECluster, machine *capi.Machine) error {
+	if _, ok := machine.Annotations[DrainedAnnotation]; !ok {
+		return nil
+	}
+
+	if machine.Status.NodeRef != nil {
+		helper, err := p.drainHelper(cluster)
+		if err != nil {
+			return err
+		}
+
+		node, err := helper.Client.CoreV1().Nodes().Get(p.ctx, machine.Status.NodeRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if err := drain.RunCordonOrUncordon(helper, node, false); err != nil {
+			return err
+		}
+	}
+
+	return p.setDrainedAnnotation(machine, "")
+}
+
+func (p *Planner) setDrainedAnnotation(machine *capi.Machine, hash string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		machine, err := p.machines.Get(machine.Namespace, machine.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if hash == "" {
+			delete(machine.Annotations, DrainedAnnotation)
+		} else {
+			if machine.Annotations == nil {
+				machine.Annotations = map[string]string{}
+			}
+			machine.Annotations[DrainedAnnotation] = hash
+		}
+		_, err = p.machines.Update(machine)
+		return err
+	})
+}
+
+// setMachineDrainCondition reports the drain of the node of the machine, failures are warnings as the drain is retried
+func (p *Planner) setMachineDrainCondition(machine *capi.Machine, status corev1.ConditionStatus, reason, message string) error {
+	desired := capi.Condition{
+		Type:    MachineDrained,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}
+	if status == corev1.ConditionFalse {
+		desired.Severity = capi.ConditionSeverityWarning
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		machine, err := p.machines.Get(machine.Namespace, machine.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		desired.LastTransitionTime = metav1.Now()
+		for i, existing := range machine.Status.Conditions {
+			if existing.Type != MachineDrained {
+				continue
+			}
+			if existing.Status == desired.Status && existing.Reason == desired.Reason && existing.Message == desired.Message {
+				return nil
+			}
+			machine.Status.Conditions[i] = desired
+			_, err = p.machines.UpdateStatus(machine)
+			return err
+		}
+
+		machine.Status.Conditions = append(machine.Status.Conditions, desired)
+		_, err = p.machines.UpdateStatus(machine)
+		return err
+	})
+}
+
+func (p *Planner) drainHelper(cluster *rkev1.RKECluster) (*drain.Helper, error) {
+	client, err := p.kubeconfig.GetClient(cluster.Namespace, cluster.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := cluster.Spec.UpgradeStrategy.DrainOptions
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultDrainTimeout
+	}
+	helper := &drain.Helper{
+		Ctx:                             p.ctx,
+		Client:                          client,
+		Force:                           opts.Force,
+		IgnoreAllDaemonSets:             opts.IgnoreDaemonSets == nil || *opts.IgnoreDaemonSets,
+		DeleteEmptyDirData:              opts.DeleteEmptyDirData,
+		GracePeriodSeconds:              -1,
+		Timeout:                         time.Duration(opts.Timeout) * time.Second,
+		SkipWaitForDeleteTimeoutSeconds: opts.SkipWaitForDeleteTimeoutSeconds,
+		Out:                             logWriter(logrus.Info),
+		ErrOut:                          logWriter(logrus.Error),
+	}
+	if opts.GracePeriod > 0 {
+		helper.GracePeriodSeconds = opts.GracePeriod
+	}
+
+	return helper, nil
+}
+
+func drainKey(machine *capi.Machine, hash string) string {
+	return fmt.Sprintf("%s/%s/%s", machine.Namespace, machine.Name, hash)
+}
+
+// logWriter sends the output of the drain helper to the log
+type logWriter func(args ...interface{})
+
+func (l logWriter) Write(p []byte) (int, error) {
+	l(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
@@ -0,0 +1,114 @@
+package planner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+func TestDrainHelperTimeout(t *testing.T) {
+	planner := newTestPlanner(t)
+	planner.kubeconfig = fakeRancher{client: fake.NewSimpleClientset()}
+	cluster := testCluster()
+
+	helper, err := planner.drainHelper(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if helper.Timeout != DefaultDrainTimeout*time.Second {
+		t.Errorf("drain without a timeout waits %s, want %ds", helper.Timeout, DefaultDrainTimeout)
+	}
+
+	cluster.Spec.UpgradeStrategy.DrainOptions.Timeout = 10
+	if helper, err = planner.drainHelper(cluster); err != nil {
+		t.Fatal(err)
+	}
+	if helper.Timeout != 10*time.Second {
+		t.Errorf("drain waits %s, want 10s", helper.Timeout)
+	}
+}
+
+func TestDrainCondition(t *testing.T) {
+	tests := []struct {
+		name   string
+		nodes  []corev1.Node
+		status corev1.ConditionStatus
+		reason string
+	}{
+		{"drained", []corev1.Node{{}}, corev1.ConditionTrue, ""},
+		{"missing node", nil, corev1.ConditionFalse, "DrainFailed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planner := newTestPlanner(t)
+			client := fake.NewSimpleClientset()
+			for _, node := range tt.nodes {
+				node.Name = "node-1"
+				if err := client.Tracker().Add(&node); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// the drain waits for the node until the progress was checked
+			release := make(chan struct{})
+			client.PrependReactor("get", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+				<-release
+				return false, nil, nil
+			})
+			planner.kubeconfig = fakeRancher{client: client}
+
+			cluster := testCluster()
+			cluster.Spec.UpgradeStrategy.DrainServerNodes = true
+			planner.addMachine(cluster, "machine-1", EtcdRoleLabel)
+			machine := planner.machines["machine-1"]
+			machine.Status.NodeRef = &corev1.ObjectReference{Name: "node-1"}
+
+			entry := planEntry{Machine: machine}
+			if done, err := planner.drain(cluster, entry, plan.NodePlan{}); done || err != nil {
+				t.Fatalf("drain() = %t, %v, want to drain in the background", done, err)
+			}
+			if got := drainCondition(planner.machines["machine-1"]); got == nil || got.Status != corev1.ConditionUnknown || got.Reason != "Draining" {
+				t.Fatalf("drain in progress is reported as %+v", got)
+			}
+			close(release)
+
+			planner.waitForDrains(t)
+			got := drainCondition(planner.machines["machine-1"])
+			if got == nil || got.Status != tt.status || got.Reason != tt.reason {
+				t.Errorf("drain is reported as %+v, want status %s, reason %q", got, tt.status, tt.reason)
+			}
+			if tt.status == corev1.ConditionFalse && (got.Severity != capi.ConditionSeverityWarning || got.Message == "") {
+				t.Errorf("drain failure is not reported as a warning with its error: %+v", got)
+			}
+		})
+	}
+}
+
+// waitForDrains waits for the drains running in the background to finish
+func (t *testPlanner) waitForDrains(tt *testing.T) {
+	for i := 0; i < 500; i++ {
+		t.drainLock.Lock()
+		draining := len(t.draining)
+		t.drainLock.Unlock()
+		if draining == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tt.Fatal("drains did not finish")
+}
+
+func drainCondition(machine *capi.Machine) *capi.Condition {
+	for i := range machine.Status.Conditions {
+		if machine.Status.Conditions[i].Type == MachineDrained {
+			return &machine.Status.Conditions[i]
+		}
+	}
+	return nil
+}
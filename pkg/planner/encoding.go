@@ -0,0 +1,87 @@
+package planner
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+)
+
+const (
+	compressionGzip = "gzip"
+	// files larger than compressThreshold are compressed
+	compressThreshold = 4096
+)
+
+// encodePlan prepares the plan to be written for the agent, large files are compressed
+func encodePlan(nodePlan plan.NodePlan) (plan.NodePlan, error) {
+	result := nodePlan
+	result.Version = plan.Version
+	result.Files = nil
+
+	for _, file := range nodePlan.Files {
+		if len(file.Content) > compressThreshold && file.Compression == "" {
+			content, err := base64.StdEncoding.DecodeString(file.Content)
+			if err != nil {
+				return result, err
+			}
+
+			buf := &bytes.Buffer{}
+			gz := gzip.NewWriter(buf)
+			if _, err := gz.Write(content); err != nil {
+				return result, err
+			}
+			if err := gz.Close(); err != nil {
+				return result, err
+			}
+
+			file.Content = base64.StdEncoding.EncodeToString(buf.Bytes())
+			file.Compression = compressionGzip
+		}
+		result.Files = append(result.Files, file)
+	}
+
+	return result, nil
+}
+
+// decodePlan reverts encodePlan so the plan can be compared to the desired plan
+func decodePlan(nodePlan plan.NodePlan) (plan.NodePlan, error) {
+	if nodePlan.Version > plan.Version {
+		return nodePlan, fmt.Errorf("plan version %d is newer than the supported version %d", nodePlan.Version, plan.Version)
+	}
+
+	result := nodePlan
+	result.Version = 0
+	result.Files = nil
+
+	for _, file := range nodePlan.Files {
+		switch file.Compression {
+		case "":
+		case compressionGzip:
+			content, err := base64.StdEncoding.DecodeString(file.Content)
+			if err != nil {
+				return result, err
+			}
+
+			gz, err := gzip.NewReader(bytes.NewReader(content))
+			if err != nil {
+				return result, err
+			}
+			content, err = ioutil.ReadAll(gz)
+			if err != nil {
+				return result, err
+			}
+
+			file.Content = base64.StdEncoding.EncodeToString(content)
+			file.Compression = ""
+		default:
+			return result, fmt.Errorf("unknown compression %s of file %s", file.Compression, file.Path)
+		}
+		result.Files = append(result.Files, file)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,51 @@
+package planner
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+func TestEncodePlan(t *testing.T) {
+	nodePlan := plan.NodePlan{
+		Files: []plan.File{
+			{Path: "/etc/small", Content: base64.StdEncoding.EncodeToString([]byte("small"))},
+			{Path: "/etc/large", Content: base64.StdEncoding.EncodeToString([]byte(strings.Repeat("large", compressThreshold)))},
+		},
+		Instructions: []plan.Instruction{{Name: "install", Command: "sh"}},
+	}
+
+	encoded, err := encodePlan(nodePlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded.Version != plan.Version {
+		t.Errorf("encoded version = %d, want %d", encoded.Version, plan.Version)
+	}
+	if encoded.Files[0].Compression != "" || encoded.Files[1].Compression != compressionGzip {
+		t.Errorf("only files above the threshold are compressed, got %q and %q", encoded.Files[0].Compression, encoded.Files[1].Compression)
+	}
+
+	decoded, err := decodePlan(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equality.Semantic.DeepEqual(decoded, nodePlan) {
+		t.Errorf("decodePlan(encodePlan()) = %+v, want %+v", decoded, nodePlan)
+	}
+}
+
+func TestDecodePlanErrors(t *testing.T) {
+	for name, nodePlan := range map[string]plan.NodePlan{
+		"newer version":       {Version: plan.Version + 1},
+		"unknown compression": {Files: []plan.File{{Path: "/etc/file", Compression: "zstd"}}},
+		"invalid gzip":        {Files: []plan.File{{Path: "/etc/file", Compression: compressionGzip, Content: "Zm9v"}}},
+	} {
+		if _, err := decodePlan(nodePlan); err == nil {
+			t.Errorf("%s: decodePlan() succeeded, want an error", name)
+		}
+	}
+}
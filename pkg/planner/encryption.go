@@ -0,0 +1,158 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher-operator/pkg/versions"
+	"github.com/rancher/wrangler/pkg/condition"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+const (
+	EncryptionKeyRotationPhasePrepare   = "Prepare"
+	EncryptionKeyRotationPhaseRotate    = "Rotate"
+	EncryptionKeyRotationPhaseReencrypt = "Reencrypt"
+)
+
+var encryptionKeyRotationPhases = []struct {
+	phase     string
+	command   string
+	condition condition.Cond
+}{
+	{EncryptionKeyRotationPhasePrepare, "prepare", EncryptionKeysPrepared},
+	{EncryptionKeyRotationPhaseRotate, "rotate", EncryptionKeysRotated},
+	{EncryptionKeyRotationPhaseReencrypt, "reencrypt", SecretsReencrypted},
+}
+
+func rotatingEncryptionKeys(cluster *rkev1.RKECluster) bool {
+	return cluster.Spec.RotateEncryptionKeys != nil &&
+		cluster.Spec.RotateEncryptionKeys.Generation != cluster.Status.EncryptionKeyRotationGeneration
+}
+
+// rotateEncryptionKeys runs the prepare, rotate and reencrypt phases of a secrets encryption key rotation. Each
+// phase runs its command on the leader, then restarts the other control plane machines one at a time. Disabling
+// secrets encryption aborts a running rotation. ErrWaiting is returned while the rotation is running.
+func (p *Planner) rotateEncryptionKeys(cluster *rkev1.RKECluster, secret plan.Secret, version *versions.Version, currentPlan *plan.Plan, joinServer string) error {
+	if !rotatingEncryptionKeys(cluster) {
+		return nil
+	}
+
+	if !cluster.Spec.SecretsEncryption {
+		err := errors.New("secrets encryption is not enabled")
+		if cluster.Status.EncryptionKeyRotationPhase != "" {
+			// the rotation starts over from the prepare phase once secrets encryption is enabled again
+			err = fmt.Errorf("secrets encryption was disabled during the %s phase, the rotation was aborted",
+				cluster.Status.EncryptionKeyRotationPhase)
+			cluster.Status.EncryptionKeyRotationPhase = ""
+			cluster.Status.EncryptionKeyRotationLeader = ""
+		}
+		for _, phase := range encryptionKeyRotationPhases {
+			phase.condition.SetError(&cluster.Status, "", err)
+		}
+		return nil
+	}
+
+	isLeader := func(machine *capi.Machine) bool {
+		return machine.Name == cluster.Status.EncryptionKeyRotationLeader
+	}
+
+	if cluster.Status.EncryptionKeyRotationPhase == "" || !anyMachine(currentPlan, isLeader) {
+		// a leader that is gone is replaced, the current phase runs again on the new leader
+		leader := encryptionKeyRotationLeader(currentPlan)
+		if leader == "" {
+			return fmt.Errorf("%w: no control plane machine to rotate the encryption keys on", ErrWaiting)
+		}
+		cluster.Status.EncryptionKeyRotationLeader = leader
+	}
+
+	if cluster.Status.EncryptionKeyRotationPhase == "" {
+		cluster.Status.EncryptionKeyRotationPhase = EncryptionKeyRotationPhasePrepare
+		for _, phase := range encryptionKeyRotationPhases {
+			phase.condition.Unknown(&cluster.Status)
+			phase.condition.Reason(&cluster.Status, "Pending")
+			phase.condition.Message(&cluster.Status, "")
+		}
+	}
+
+	started := false
+	for _, phase := range encryptionKeyRotationPhases {
+		if phase.phase == cluster.Status.EncryptionKeyRotationPhase {
+			started = true
+		}
+		if !started {
+			continue
+		}
+
+		cluster.Status.EncryptionKeyRotationPhase = phase.phase
+		phase.condition.Reason(&cluster.Status, "InProgress")
+
+		phase.condition.Message(&cluster.Status, fmt.Sprintf("running secrets-encrypt %s on %s", phase.command,
+			cluster.Status.EncryptionKeyRotationLeader))
+		ok, err := p.reconcile(cluster, secret, version, currentPlan, isLeader, none, 1, joinServer)
+		if err != nil || !ok {
+			return waiting(err, fmt.Sprintf("waiting for secrets-encrypt %s", phase.command))
+		}
+
+		phase.condition.Message(&cluster.Status, "restarting control plane machines")
+		ok, err = p.reconcile(cluster, secret, version, currentPlan, isControlPlane, isLeader, 1, joinServer)
+		if err != nil || !ok {
+			return waiting(err, fmt.Sprintf("waiting for control plane machines to restart after secrets-encrypt %s", phase.command))
+		}
+
+		phase.condition.SetError(&cluster.Status, "", nil)
+	}
+
+	cluster.Status.EncryptionKeyRotationGeneration = cluster.Spec.RotateEncryptionKeys.Generation
+	cluster.Status.EncryptionKeyRotationPhase = ""
+	cluster.Status.EncryptionKeyRotationLeader = ""
+	return nil
+}
+
+// encryptionKeyRotationLeader prefers the init node and otherwise picks the first control plane machine
+func encryptionKeyRotationLeader(currentPlan *plan.Plan) string {
+	entries, _ := collect(currentPlan, isControlPlane, none)
+	for _, entry := range entries {
+		if isInitNode(entry.Machine) {
+			return entry.Machine.Name
+		}
+	}
+	if len(entries) > 0 {
+		return entries[0].Machine.Name
+	}
+	return ""
+}
+
+// encryptionKeyRotationInstruction runs the command of the current phase on the leader and restarts the other control
+// plane machines once the leader is done. Each phase is a one time instruction, so moving on to the next phase rolls
+// out the next command but dropping the last one does not roll out the machines again.
+func encryptionKeyRotationInstruction(cluster *rkev1.RKECluster, machine *capi.Machine) *plan.Instruction {
+	if !rotatingEncryptionKeys(cluster) || !cluster.Spec.SecretsEncryption || cluster.Status.EncryptionKeyRotationPhase == "" ||
+		!isControlPlane(machine) {
+		return nil
+	}
+
+	var (
+		runtime = GetRuntime(cluster.Spec.KubernetesVersion)
+		unit    = GetRuntimeServerUnit(cluster.Spec.KubernetesVersion)
+		script  = fmt.Sprintf("systemctl restart %s", unit)
+	)
+
+	for _, phase := range encryptionKeyRotationPhases {
+		if phase.phase != cluster.Status.EncryptionKeyRotationPhase {
+			continue
+		}
+		if machine.Name == cluster.Status.EncryptionKeyRotationLeader {
+			script = fmt.Sprintf("%s secrets-encrypt %s && %s", runtime, phase.command, script)
+		}
+		return &plan.Instruction{
+			Name:    fmt.Sprintf("encryption-keys-%s-%d", phase.command, cluster.Spec.RotateEncryptionKeys.Generation),
+			Command: "sh",
+			Args:    []string{"-c", script},
+		}
+	}
+
+	return nil
+}
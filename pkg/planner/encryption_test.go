@@ -0,0 +1,104 @@
+package planner
+
+import (
+	"strings"
+	"testing"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+func TestProcessEncryptionKeyRotation(t *testing.T) {
+	planner := newTestPlanner(t)
+	cluster := testCluster()
+	cluster.Spec.SecretsEncryption = true
+	planner.addMachine(cluster, "machine-1", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+	planner.addMachine(cluster, "machine-2", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+	planner.process(t, cluster)
+
+	cluster.Spec.RotateEncryptionKeys = &rkev1.RotateEncryptionKeys{Generation: 1}
+	planner.step(t, cluster)
+	if cluster.Status.EncryptionKeyRotationPhase != EncryptionKeyRotationPhasePrepare || cluster.Status.EncryptionKeyRotationLeader != "machine-1" {
+		t.Fatalf("rotation started in phase %q on %q, want the prepare phase on the init node",
+			cluster.Status.EncryptionKeyRotationPhase, cluster.Status.EncryptionKeyRotationLeader)
+	}
+	if script := encryptionScript(planner.plan(t, "machine-1"), "encryption-keys-prepare-1"); !strings.Contains(script, "k3s secrets-encrypt prepare") {
+		t.Errorf("leader does not run secrets-encrypt prepare: %q", script)
+	}
+
+	// the other control plane machine restarts once the leader is done
+	phases := []string{cluster.Status.EncryptionKeyRotationPhase}
+	for i := 0; i < 20 && cluster.Status.EncryptionKeyRotationPhase != ""; i++ {
+		planner.step(t, cluster)
+		if phase := cluster.Status.EncryptionKeyRotationPhase; phase != phases[len(phases)-1] {
+			phases = append(phases, phase)
+		}
+	}
+
+	want := []string{EncryptionKeyRotationPhasePrepare, EncryptionKeyRotationPhaseRotate, EncryptionKeyRotationPhaseReencrypt, ""}
+	if !equality.Semantic.DeepEqual(phases, want) {
+		t.Errorf("rotation went through the phases %q, want %q", phases, want)
+	}
+	if cluster.Status.EncryptionKeyRotationGeneration != 1 || cluster.Status.EncryptionKeyRotationLeader != "" {
+		t.Errorf("rotation did not finish: %+v", cluster.Status)
+	}
+	for _, phase := range encryptionKeyRotationPhases {
+		if !phase.condition.IsTrue(&cluster.Status) {
+			t.Errorf("condition of the %s phase is not true", phase.phase)
+		}
+	}
+	if script := encryptionScript(planner.plan(t, "machine-2"), "encryption-keys-reencrypt-1"); script != "systemctl restart k3s" {
+		t.Errorf("machine-2 runs %q in the reencrypt phase, want a restart", script)
+	}
+}
+
+func TestProcessEncryptionKeyRotationAbort(t *testing.T) {
+	planner := newTestPlanner(t)
+	cluster := testCluster()
+	cluster.Spec.SecretsEncryption = true
+	planner.addMachine(cluster, "machine-1", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+	planner.process(t, cluster)
+
+	cluster.Spec.RotateEncryptionKeys = &rkev1.RotateEncryptionKeys{Generation: 1}
+	for i := 0; i < 20 && cluster.Status.EncryptionKeyRotationPhase != EncryptionKeyRotationPhaseRotate; i++ {
+		planner.step(t, cluster)
+	}
+	if cluster.Status.EncryptionKeyRotationPhase != EncryptionKeyRotationPhaseRotate {
+		t.Fatalf("rotation did not reach the rotate phase: %+v", cluster.Status)
+	}
+
+	// the init node rolls out the config without secrets encryption before the rotation is aborted
+	cluster.Spec.SecretsEncryption = false
+	for i := 0; i < 5 && cluster.Status.EncryptionKeyRotationPhase != ""; i++ {
+		planner.step(t, cluster)
+	}
+	if cluster.Status.EncryptionKeyRotationPhase != "" || cluster.Status.EncryptionKeyRotationLeader != "" {
+		t.Errorf("disabling secrets encryption kept the rotation in phase %q", cluster.Status.EncryptionKeyRotationPhase)
+	}
+	if !EncryptionKeysRotated.IsFalse(&cluster.Status) || !strings.Contains(EncryptionKeysRotated.GetMessage(&cluster.Status), "aborted") {
+		t.Errorf("abort is not reported: %q", EncryptionKeysRotated.GetMessage(&cluster.Status))
+	}
+	if hasInstruction(planner.plan(t, "machine-1"), "encryption-keys-") {
+		t.Error("plan of machine-1 runs secrets-encrypt without secrets encryption")
+	}
+
+	// the rotation starts over once secrets encryption is enabled again
+	cluster.Spec.SecretsEncryption = true
+	for i := 0; i < 5 && cluster.Status.EncryptionKeyRotationPhase == ""; i++ {
+		planner.step(t, cluster)
+	}
+	if cluster.Status.EncryptionKeyRotationPhase != EncryptionKeyRotationPhasePrepare {
+		t.Errorf("rotation restarted in phase %q, want the prepare phase", cluster.Status.EncryptionKeyRotationPhase)
+	}
+}
+
+// encryptionScript returns the script of the instruction with the given name in the plan
+func encryptionScript(nodePlan plan.NodePlan, name string) string {
+	for _, instruction := range nodePlan.Instructions {
+		if instruction.Name == name && len(instruction.Args) > 1 {
+			return instruction.Args[1]
+		}
+	}
+	return ""
+}
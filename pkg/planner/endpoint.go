@@ -0,0 +1,38 @@
+package planner
+
+import (
+	"fmt"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/wrangler/pkg/data/convert"
+)
+
+// registrationURL is the URL machines join through, the registration endpoint of the cluster if set and the join URL
+// of the init node otherwise
+func registrationURL(cluster *rkev1.RKECluster, joinServer string) string {
+	if cluster.Spec.RegistrationEndpoint == "" {
+		return joinServer
+	}
+	return fmt.Sprintf("https://%s:%d", cluster.Spec.RegistrationEndpoint, GetRuntimeSupervisorPort(cluster.Spec.KubernetesVersion))
+}
+
+// addTLSSAN adds san to the tls-san list of the config, keeping the values supplied by the user
+func addTLSSAN(config map[string]interface{}, san string) {
+	if san == "" {
+		return
+	}
+
+	var sans []string
+	if value, ok := config["tls-san"].(string); ok {
+		sans = []string{value}
+	} else {
+		sans = convert.ToStringSlice(config["tls-san"])
+	}
+
+	for _, existing := range sans {
+		if existing == san {
+			return
+		}
+	}
+	config["tls-san"] = append(sans, san)
+}
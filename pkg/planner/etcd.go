@@ -0,0 +1,323 @@
+package planner
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/wrangler/pkg/data/convert"
+	"k8s.io/apimachinery/pkg/api/equality"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+const (
+	ETCDRestorePhaseShutdown = "Shutdown"
+	ETCDRestorePhaseRestore  = "Restore"
+	ETCDRestorePhaseFinished = "Finished"
+)
+
+// etcdConfig returns the config keys for the snapshot settings of the cluster and the files they reference
+func (p *Planner) etcdConfig(cluster *rkev1.RKECluster, runtime string) (map[string]interface{}, []plan.File, error) {
+	config := map[string]interface{}{}
+	etcd := cluster.Spec.ETCD
+	if etcd == nil {
+		return config, nil, nil
+	}
+
+	if etcd.DisableSnapshots {
+		config["etcd-disable-snapshots"] = true
+	}
+	if etcd.SnapshotScheduleCron != "" {
+		config["etcd-snapshot-schedule-cron"] = etcd.SnapshotScheduleCron
+	}
+	if etcd.SnapshotRetention > 0 {
+		config["etcd-snapshot-retention"] = etcd.SnapshotRetention
+	}
+
+	s3Config, files, err := p.etcdS3Config(cluster, runtime)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range s3Config {
+		config[k] = v
+	}
+
+	// the config file is only readable by root, unlike the args of a process
+	accessKey, secretKey, err := p.etcdS3Credentials(cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	if accessKey != "" {
+		config["etcd-s3-access-key"] = accessKey
+	}
+	if secretKey != "" {
+		config["etcd-s3-secret-key"] = secretKey
+	}
+
+	return config, files, nil
+}
+
+func (p *Planner) etcdS3Config(cluster *rkev1.RKECluster, runtime string) (map[string]interface{}, []plan.File, error) {
+	if cluster.Spec.ETCD == nil || cluster.Spec.ETCD.S3 == nil {
+		return nil, nil, nil
+	}
+
+	var (
+		s3     = cluster.Spec.ETCD.S3
+		files  []plan.File
+		config = map[string]interface{}{
+			"etcd-s3": true,
+		}
+	)
+
+	if s3.Endpoint != "" {
+		config["etcd-s3-endpoint"] = s3.Endpoint
+	}
+	if s3.Bucket != "" {
+		config["etcd-s3-bucket"] = s3.Bucket
+	}
+	if s3.Region != "" {
+		config["etcd-s3-region"] = s3.Region
+	}
+	if s3.Folder != "" {
+		config["etcd-s3-folder"] = s3.Folder
+	}
+	if s3.SkipSSLVerify {
+		config["etcd-s3-skip-ssl-verify"] = true
+	}
+	if s3.EndpointCA != "" {
+		path := fmt.Sprintf("/etc/rancher/%s/etcd-s3-ca.crt", runtime)
+		config["etcd-s3-endpoint-ca"] = path
+		files = append(files, plan.File{
+			Content: base64.StdEncoding.EncodeToString([]byte(s3.EndpointCA)),
+			Path:    path,
+		})
+	}
+
+	return config, files, nil
+}
+
+// etcdS3Credentials returns the access and secret key of the credential secret of the S3 config, if any
+func (p *Planner) etcdS3Credentials(cluster *rkev1.RKECluster) (string, string, error) {
+	if cluster.Spec.ETCD == nil || cluster.Spec.ETCD.S3 == nil || cluster.Spec.ETCD.S3.CredentialSecretName == "" {
+		return "", "", nil
+	}
+
+	secret, err := p.secretCache.Get(cluster.Namespace, cluster.Spec.ETCD.S3.CredentialSecretName)
+	if err != nil {
+		return "", "", err
+	}
+	return string(secret.Data["accessKey"]), string(secret.Data["secretKey"]), nil
+}
+
+// etcdS3Env passes the S3 credentials to the etcd-snapshot and cluster-reset commands, which read them from the
+// environment if the flags are not set
+func (p *Planner) etcdS3Env(cluster *rkev1.RKECluster) ([]string, error) {
+	accessKey, secretKey, err := p.etcdS3Credentials(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	var env []string
+	if accessKey != "" {
+		env = append(env, "AWS_ACCESS_KEY_ID="+accessKey)
+	}
+	if secretKey != "" {
+		env = append(env, "AWS_SECRET_ACCESS_KEY="+secretKey)
+	}
+	return env, nil
+}
+
+func creatingETCDSnapshot(cluster *rkev1.RKECluster) bool {
+	return cluster.Spec.ETCDSnapshotCreate != nil &&
+		cluster.Spec.ETCDSnapshotCreate.Generation != cluster.Status.ETCDSnapshotCreateGeneration
+}
+
+// createETCDSnapshot takes an on-demand snapshot on the init node while the create generation differs from the
+// generation of the last snapshot taken. The snapshot is taken by a plan of its own that keeps the files of the
+// current plan of the init node, so the runtime is not installed again and the node is not drained. ErrWaiting is
+// returned while the snapshot is taken.
+func (p *Planner) createETCDSnapshot(cluster *rkev1.RKECluster, currentPlan *plan.Plan) error {
+	if !creatingETCDSnapshot(cluster) {
+		return nil
+	}
+
+	runtime := GetRuntime(cluster.Spec.KubernetesVersion)
+	s3Config, _, err := p.etcdS3Config(cluster, runtime)
+	if err != nil {
+		return err
+	}
+
+	env, err := p.etcdS3Env(cluster)
+	if err != nil {
+		return err
+	}
+
+	snapshot := plan.Instruction{
+		Name:    fmt.Sprintf("etcd-snapshot-%d", cluster.Spec.ETCDSnapshotCreate.Generation),
+		Command: runtime,
+		Args:    append([]string{"etcd-snapshot", "--name=on-demand"}, toArgs(s3Config)...),
+		Env:     env,
+	}
+
+	ok, err := p.rollout(cluster, currentPlan, isInitNode, none, 1, 0, false, func(entry planEntry) (plan.NodePlan, error) {
+		return snapshotPlan(entry, snapshot), nil
+	})
+	if err != nil || !ok {
+		return waiting(err, "waiting for etcd snapshot to be taken")
+	}
+
+	cluster.Status.ETCDSnapshotCreateGeneration = cluster.Spec.ETCDSnapshotCreate.Generation
+	return nil
+}
+
+// snapshotPlan runs the snapshot instruction with the files and probes of the current plan of the machine. Only a
+// machine with a plan history can tell the plan the snapshot ran on, others run the snapshot as part of their plan.
+func snapshotPlan(entry planEntry, snapshot plan.Instruction) plan.NodePlan {
+	if entry.Plan == nil {
+		return plan.NodePlan{Instructions: []plan.Instruction{snapshot}}
+	}
+	if len(entry.Plan.History) == 0 {
+		result := entry.Plan.Plan
+		result.Instructions = append(append([]plan.Instruction{}, result.Instructions...), snapshot)
+		return result
+	}
+
+	return plan.NodePlan{
+		Files:        entry.Plan.Plan.Files,
+		Instructions: []plan.Instruction{snapshot},
+		Probes:       entry.Plan.Plan.Probes,
+	}
+}
+
+// restoreETCDSnapshot stops all etcd and control plane machines, restores the snapshot on the init node and then
+// leaves it to the regular rollout to rejoin the other machines. Machines are stopped at the server concurrency and
+// held machines block the restore. ErrWaiting is returned while the restore is running.
+func (p *Planner) restoreETCDSnapshot(cluster *rkev1.RKECluster, currentPlan *plan.Plan) error {
+	restore := cluster.Spec.ETCDSnapshotRestore
+	if restore == nil || restore.Name == "" {
+		return nil
+	}
+
+	if !equality.Semantic.DeepEqual(restore, cluster.Status.ETCDSnapshotRestore) {
+		cluster.Status.ETCDSnapshotRestore = restore.DeepCopy()
+		cluster.Status.ETCDSnapshotRestorePhase = ETCDRestorePhaseShutdown
+	}
+
+	if cluster.Spec.Paused && cluster.Status.ETCDSnapshotRestorePhase != ETCDRestorePhaseFinished {
+		return fmt.Errorf("%w: cluster is paused, etcd snapshot restore is pending", ErrWaiting)
+	}
+
+	runtime := GetRuntime(cluster.Spec.KubernetesVersion)
+
+	switch cluster.Status.ETCDSnapshotRestorePhase {
+	case ETCDRestorePhaseShutdown:
+		ok, err := p.rollout(cluster, currentPlan, isEtcdOrControlPlane, none, cluster.Spec.UpgradeStrategy.ServerConcurrency, 0, false,
+			func(entry planEntry) (plan.NodePlan, error) {
+				return shutdownPlan(cluster, entry.Machine), nil
+			})
+		if err != nil || !ok {
+			return waiting(err, "waiting for etcd and control plane machines to stop")
+		}
+		cluster.Status.ETCDSnapshotRestorePhase = ETCDRestorePhaseRestore
+		fallthrough
+	case ETCDRestorePhaseRestore:
+		snapshot, err := p.etcdSnapshotCache.Get(cluster.Namespace, restore.Name)
+		if err != nil {
+			return err
+		}
+
+		initNodes, _ := collect(currentPlan, isInitNode, none)
+		if len(initNodes) != 1 {
+			return fmt.Errorf("%w: can not restore etcd snapshot without an init node", ErrWaiting)
+		}
+
+		restorePath := snapshot.Spec.SnapshotName
+		if !snapshot.Spec.S3 {
+			if nodeRef := initNodes[0].Machine.Status.NodeRef; nodeRef != nil && nodeRef.Name != snapshot.Spec.NodeName {
+				return fmt.Errorf("etcd snapshot %s is stored on node %s, it can only be restored from there or from S3",
+					snapshot.Name, snapshot.Spec.NodeName)
+			}
+			restorePath = strings.TrimPrefix(snapshot.Spec.Location, "file://")
+		}
+
+		s3Config, _, err := p.etcdS3Config(cluster, runtime)
+		if err != nil {
+			return err
+		}
+
+		env, err := p.etcdS3Env(cluster)
+		if err != nil {
+			return err
+		}
+
+		ok, err := p.rollout(cluster, currentPlan, isInitNode, none, 1, 0, false, func(entry planEntry) (plan.NodePlan, error) {
+			return restorePlan(runtime, restorePath, s3Config, env), nil
+		})
+		if err != nil || !ok {
+			return waiting(err, "waiting for etcd snapshot to be restored")
+		}
+		cluster.Status.ETCDSnapshotRestorePhase = ETCDRestorePhaseFinished
+	}
+
+	return nil
+}
+
+func shutdownPlan(cluster *rkev1.RKECluster, machine *capi.Machine) plan.NodePlan {
+	script := fmt.Sprintf("systemctl stop %s", GetRuntimeServerUnit(cluster.Spec.KubernetesVersion))
+	if isEtcd(machine) && !isInitNode(machine) {
+		// etcd members other than the init node join the restored etcd cluster with an empty data dir
+		script += fmt.Sprintf(" && rm -rf /var/lib/rancher/%s/server/db", GetRuntime(cluster.Spec.KubernetesVersion))
+	}
+	return plan.NodePlan{
+		Instructions: []plan.Instruction{
+			{
+				Name:    "etcd-restore-shutdown",
+				Command: "sh",
+				Args:    []string{"-c", script},
+			},
+		},
+	}
+}
+
+func restorePlan(runtime, restorePath string, s3Config map[string]interface{}, env []string) plan.NodePlan {
+	return plan.NodePlan{
+		Instructions: []plan.Instruction{
+			{
+				Name:    "etcd-restore",
+				Command: runtime,
+				Args: append([]string{
+					"server",
+					"--cluster-reset",
+					"--cluster-reset-restore-path=" + restorePath,
+				}, toArgs(s3Config)...),
+				Env: env,
+			},
+		},
+	}
+}
+
+func waiting(err error, msg string) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrWaiting, msg)
+}
+
+// toArgs converts config keys to command line flags, sorted for a stable plan
+func toArgs(config map[string]interface{}) (result []string) {
+	for k, v := range config {
+		if b, ok := v.(bool); ok {
+			if b {
+				result = append(result, "--"+k)
+			}
+			continue
+		}
+		result = append(result, fmt.Sprintf("--%s=%s", k, convert.ToString(v)))
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,153 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+const (
+	// MachinePlanApplied is the condition of a machine reporting whether its current plan is applied
+	MachinePlanApplied capi.ConditionType = "PlanApplied"
+
+	// DefaultMaxFailures is the number of failed attempts to apply a plan after which the rollout halts
+	DefaultMaxFailures = 5
+	maxFailureOutput   = 1024
+)
+
+var (
+	retryBaseDelay = 10 * time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+func maxFailures(cluster *rkev1.RKECluster) int {
+	if cluster.Spec.UpgradeStrategy.MaxFailures > 0 {
+		return cluster.Spec.UpgradeStrategy.MaxFailures
+	}
+	return DefaultMaxFailures
+}
+
+// failedMachines returns the names of the machines that failed to apply their plan at least max failures times
+func failedMachines(cluster *rkev1.RKECluster, currentPlan *plan.Plan) (result []string) {
+	for name, node := range currentPlan.Nodes {
+		if node.Failures >= maxFailures(cluster) {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// setPlanConditions reports the plan status on each machine and whether the rollout of the cluster is halted
+// because a machine failed too often
+func (p *Planner) setPlanConditions(cluster *rkev1.RKECluster, currentPlan *plan.Plan) error {
+	for name, machine := range currentPlan.Machines {
+		if err := p.setMachinePlanCondition(machine, currentPlan.Nodes[name]); err != nil {
+			return err
+		}
+	}
+
+	failed := failedMachines(cluster, currentPlan)
+	if len(failed) == 0 {
+		PlansApplied.SetError(&cluster.Status, "", nil)
+		return nil
+	}
+
+	node := currentPlan.Nodes[failed[0]]
+	msg := fmt.Sprintf("rollout halted, machine %s failed to apply its plan %d times: %s",
+		failed[0], node.Failures, truncate(node.FailureOutput))
+	if len(failed) > 1 {
+		msg += fmt.Sprintf(" (%d more failed machines)", len(failed)-1)
+	}
+	PlansApplied.SetError(&cluster.Status, "Failed", errors.New(msg))
+	return nil
+}
+
+func (p *Planner) setMachinePlanCondition(machine *capi.Machine, node *plan.Node) error {
+	if node == nil {
+		return nil
+	}
+
+	desired := capi.Condition{
+		Type:   MachinePlanApplied,
+		Status: corev1.ConditionTrue,
+	}
+	if node.Failures > 0 {
+		desired.Status = corev1.ConditionFalse
+		desired.Severity = capi.ConditionSeverityError
+		desired.Reason = "Failed"
+		desired.Message = fmt.Sprintf("failed %d times: %s", node.Failures, truncate(node.FailureOutput))
+	} else if !node.InSync {
+		desired.Status = corev1.ConditionUnknown
+		desired.Reason = "Applying"
+	} else if !node.Healthy {
+		desired.Status = corev1.ConditionUnknown
+		desired.Reason = "Probing"
+		desired.Message = "waiting for probes to pass: " + strings.Join(failingProbes(node.AppliedPlan, node.ProbeStatus), ", ")
+	}
+
+	machine = machine.DeepCopy()
+	for i, existing := range machine.Status.Conditions {
+		if existing.Type != MachinePlanApplied {
+			continue
+		}
+		if existing.Status == desired.Status && existing.Reason == desired.Reason && existing.Message == desired.Message {
+			return nil
+		}
+		desired.LastTransitionTime = metav1.Now()
+		machine.Status.Conditions[i] = desired
+		_, err := p.machines.UpdateStatus(machine)
+		return err
+	}
+
+	desired.LastTransitionTime = metav1.Now()
+	machine.Status.Conditions = append(machine.Status.Conditions, desired)
+	_, err := p.machines.UpdateStatus(machine)
+	return err
+}
+
+// retryFailedPlan asks the agent to apply the failed plan of the entry again once the backoff of its last
+// failure has passed
+func (p *Planner) retryFailedPlan(cluster *rkev1.RKECluster, entry planEntry) error {
+	if entry.Plan.Attempt >= entry.Plan.Failures {
+		// already retrying
+		return nil
+	}
+
+	if entry.Plan.FailedAt != nil {
+		if wait := retryDelay(entry.Plan.Failures) - time.Since(entry.Plan.FailedAt.Time); wait > 0 {
+			p.rkeClusters.EnqueueAfter(cluster.Namespace, cluster.Name, wait)
+			return nil
+		}
+	}
+
+	return p.store.RetryPlan(entry.Machine, entry.Plan.Failures)
+}
+
+func retryDelay(failures int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < failures && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		return retryMaxDelay
+	}
+	return delay
+}
+
+// truncate keeps the end of the output, which usually holds the error
+func truncate(output string) string {
+	output = strings.TrimSpace(output)
+	if len(output) > maxFailureOutput {
+		return "..." + output[len(output)-maxFailureOutput:]
+	}
+	return output
+}
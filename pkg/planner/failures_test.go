@@ -0,0 +1,135 @@
+package planner
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFailedMachines(t *testing.T) {
+	nodes := map[string]*plan.Node{
+		"machine-a": {Failures: 6},
+		"machine-b": {Failures: 5},
+		"machine-c": {Failures: 2},
+		"machine-d": {},
+	}
+
+	tests := []struct {
+		name        string
+		maxFailures int
+		want        []string
+	}{
+		{"default threshold", 0, []string{"machine-a", "machine-b"}},
+		{"lower threshold", 2, []string{"machine-a", "machine-b", "machine-c"}},
+		{"higher threshold", 10, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &rkev1.RKECluster{}
+			cluster.Spec.UpgradeStrategy.MaxFailures = tt.maxFailures
+
+			got := failedMachines(cluster, &plan.Plan{Nodes: nodes})
+			if !equality.Semantic.DeepEqual(got, tt.want) {
+				t.Errorf("failedMachines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{5, 160 * time.Second},
+		{6, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := retryDelay(tt.failures); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestRetryFailedPlan(t *testing.T) {
+	recent := metav1.NewTime(time.Now().Add(-5 * time.Second))
+	old := metav1.NewTime(time.Now().Add(-time.Hour))
+
+	tests := []struct {
+		name     string
+		node     plan.Node
+		retry    bool
+		attempts string
+	}{
+		{"already retrying", plan.Node{Failures: 2, Attempt: 2, FailedAt: &old}, false, ""},
+		{"backoff running", plan.Node{Failures: 2, Attempt: 1, FailedAt: &recent}, false, ""},
+		{"backoff passed", plan.Node{Failures: 2, Attempt: 1, FailedAt: &old}, true, "2"},
+		{"failure time unknown", plan.Node{Failures: 1}, true, "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planner := newTestPlanner(t)
+			cluster := testCluster()
+			planner.addMachine(cluster, "machine-1", EtcdRoleLabel)
+			machine := planner.machines["machine-1"]
+
+			if err := planner.retryFailedPlan(cluster, planEntry{Machine: machine, Plan: &tt.node}); err != nil {
+				t.Fatal(err)
+			}
+			attempt, ok := planner.secrets[machine.Namespace+"/"+PlanSecretFromMachine(machine)].Data["attempt"]
+			if ok != tt.retry || string(attempt) != tt.attempts {
+				t.Errorf("retryFailedPlan() set attempt %q, want %q", attempt, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestNewPlanResetsRetries(t *testing.T) {
+	planner := newTestPlanner(t)
+	cluster := testCluster()
+	planner.addMachine(cluster, "machine-1", EtcdRoleLabel)
+	machine := planner.machines["machine-1"]
+	failed := plan.NodePlan{Instructions: []plan.Instruction{{Name: "failing", Command: "false"}}}
+
+	if err := planner.store.UpdatePlan(machine, failed, 1); err != nil {
+		t.Fatal(err)
+	}
+	secret := planner.secrets[machine.Namespace+"/"+PlanSecretFromMachine(machine)]
+	secret.Data["failed-checksum"] = []byte(checksum(secret.Data["plan"]))
+	secret.Data["failure-count"] = []byte(strconv.Itoa(3))
+	if err := planner.store.RetryPlan(machine, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := planner.store.secretToNode(planner.secrets[secret.Namespace+"/"+secret.Name])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Failures != 3 || node.Attempt != 3 {
+		t.Fatalf("failed plan has %d failures and attempt %d, want 3 and 3", node.Failures, node.Attempt)
+	}
+
+	if err := planner.store.UpdatePlan(machine, plan.NodePlan{Instructions: []plan.Instruction{{Name: "fixed", Command: "true"}}}, 2); err != nil {
+		t.Fatal(err)
+	}
+	node, err = planner.store.secretToNode(planner.secrets[secret.Namespace+"/"+secret.Name])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Failures != 0 || node.Attempt != 0 || node.FailedAt != nil {
+		t.Errorf("new plan keeps the failures %d and attempt %d of the failed plan", node.Failures, node.Attempt)
+	}
+}
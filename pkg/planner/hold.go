@@ -0,0 +1,51 @@
+package planner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+// HoldAnnotation set to "true" on a machine keeps its current plan while the rest of the cluster is rolled out
+const HoldAnnotation = "rke.cattle.io/hold"
+
+func isHeld(machine *capi.Machine) bool {
+	return machine.Annotations[HoldAnnotation] == "true"
+}
+
+// held is true if no new plan may be written to the machine
+func held(cluster *rkev1.RKECluster, machine *capi.Machine) bool {
+	return cluster.Spec.Paused || isHeld(machine)
+}
+
+// setHeldMachines reports the held machines and whether the rollout of the cluster is paused
+func setHeldMachines(cluster *rkev1.RKECluster, currentPlan *plan.Plan) {
+	var heldMachines []string
+	for name, machine := range currentPlan.Machines {
+		if isHeld(machine) {
+			heldMachines = append(heldMachines, name)
+		}
+	}
+	sort.Strings(heldMachines)
+	cluster.Status.HeldMachines = heldMachines
+
+	switch {
+	case cluster.Spec.Paused:
+		RolloutPaused.True(&cluster.Status)
+		RolloutPaused.Reason(&cluster.Status, "Paused")
+		RolloutPaused.Message(&cluster.Status, "cluster is paused, no new plans are written")
+	case len(heldMachines) > 0:
+		RolloutPaused.True(&cluster.Status)
+		RolloutPaused.Reason(&cluster.Status, "Held")
+		RolloutPaused.Message(&cluster.Status, fmt.Sprintf("machines %s are held, no new plans are written to them",
+			strings.Join(heldMachines, ", ")))
+	default:
+		RolloutPaused.False(&cluster.Status)
+		RolloutPaused.Reason(&cluster.Status, "")
+		RolloutPaused.Message(&cluster.Status, "")
+	}
+}
@@ -0,0 +1,122 @@
+package planner
+
+import (
+	"testing"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"k8s.io/apimachinery/pkg/api/equality"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+func TestHeld(t *testing.T) {
+	tests := []struct {
+		name        string
+		paused      bool
+		annotations map[string]string
+		want        bool
+	}{
+		{"rolled out", false, nil, false},
+		{"cluster paused", true, nil, true},
+		{"machine held", false, map[string]string{HoldAnnotation: "true"}, true},
+		{"hold released", false, map[string]string{HoldAnnotation: "false"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &rkev1.RKECluster{}
+			cluster.Spec.Paused = tt.paused
+			machine := testMachine("machine-1", nil)
+			machine.Annotations = tt.annotations
+
+			if got := held(cluster, machine); got != tt.want {
+				t.Errorf("held() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetHeldMachines(t *testing.T) {
+	heldMachine := func(name string) *capi.Machine {
+		machine := testMachine(name, nil)
+		machine.Annotations = map[string]string{HoldAnnotation: "true"}
+		return machine
+	}
+
+	tests := []struct {
+		name     string
+		paused   bool
+		machines []*capi.Machine
+		held     []string
+		status   string
+		reason   string
+	}{
+		{"rolled out", false, []*capi.Machine{testMachine("machine-a", nil)}, nil, "False", ""},
+		{"cluster paused", true, []*capi.Machine{testMachine("machine-a", nil)}, nil, "True", "Paused"},
+		{"machines held", false, []*capi.Machine{heldMachine("machine-c"), testMachine("machine-a", nil), heldMachine("machine-b")},
+			[]string{"machine-b", "machine-c"}, "True", "Held"},
+		{"paused cluster with held machines", true, []*capi.Machine{heldMachine("machine-b")}, []string{"machine-b"}, "True", "Paused"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &rkev1.RKECluster{}
+			cluster.Spec.Paused = tt.paused
+			// a previous run reported other held machines
+			cluster.Status.HeldMachines = []string{"machine-x"}
+			currentPlan := &plan.Plan{Machines: map[string]*capi.Machine{}}
+			for _, machine := range tt.machines {
+				currentPlan.Machines[machine.Name] = machine
+			}
+
+			setHeldMachines(cluster, currentPlan)
+			if !equality.Semantic.DeepEqual(cluster.Status.HeldMachines, tt.held) {
+				t.Errorf("held machines = %v, want %v", cluster.Status.HeldMachines, tt.held)
+			}
+			if status := RolloutPaused.GetStatus(&cluster.Status); status != tt.status {
+				t.Errorf("rollout paused = %q, want %q", status, tt.status)
+			}
+			if reason := RolloutPaused.GetReason(&cluster.Status); reason != tt.reason {
+				t.Errorf("rollout paused reason = %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestProcessHeldMachine(t *testing.T) {
+	planner := newTestPlanner(t)
+	cluster := testCluster()
+	planner.addMachine(cluster, "machine-1", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+	planner.addMachine(cluster, "machine-2", WorkerRoleLabel)
+	planner.process(t, cluster)
+
+	planner.machines["machine-2"].Annotations[HoldAnnotation] = "true"
+	held := planner.plan(t, "machine-2")
+	cluster.Spec.KubernetesVersion = "v1.20.5+k3s1"
+	planner.process(t, cluster)
+
+	if !equality.Semantic.DeepEqual(planner.plan(t, "machine-2"), held) {
+		t.Error("held machine got a new plan")
+	}
+	if install, _ := findInstallInstruction(planner.plan(t, "machine-1")); !hasEnv(install, "INSTALL_K3S_VERSION=v1.20.5+k3s1") {
+		t.Error("machines that are not held are not upgraded")
+	}
+	if cluster.Status.KubernetesVersion == "v1.20.5+k3s1" || !RolloutPaused.IsTrue(&cluster.Status) {
+		t.Errorf("upgrade finished while machine-2 is held: %+v", cluster.Status)
+	}
+
+	delete(planner.machines["machine-2"].Annotations, HoldAnnotation)
+	planner.process(t, cluster)
+	if cluster.Status.KubernetesVersion != "v1.20.5+k3s1" || !RolloutPaused.IsFalse(&cluster.Status) {
+		t.Errorf("upgrade did not finish once machine-2 was released: %+v", cluster.Status)
+	}
+}
+
+func hasEnv(instruction plan.Instruction, env string) bool {
+	for _, e := range instruction.Env {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
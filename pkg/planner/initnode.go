@@ -0,0 +1,227 @@
+package planner
+
+import (
+	"time"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+// InitNodePinAnnotation set to "true" on an etcd machine makes it the init node regardless of its health
+const InitNodePinAnnotation = "rke.cattle.io/init-node-pinned"
+
+// initNodeUnhealthyTimeout is how long the init node may be unhealthy before another machine is elected
+var initNodeUnhealthyTimeout = 5 * time.Minute
+
+func (p *Planner) clearInitNodeMark(currentPlan *plan.Plan, machine *capi.Machine) error {
+	if _, ok := machine.Labels[InitNodeLabel]; !ok {
+		return nil
+	}
+	machine = machine.DeepCopy()
+	delete(machine.Labels, InitNodeLabel)
+	machine, err := p.machines.Update(machine)
+	if err != nil {
+		return err
+	}
+	// later stages of this run see the change
+	currentPlan.Machines[machine.Name] = machine
+	return nil
+}
+
+func (p *Planner) setInitNodeMark(machine *capi.Machine) (*capi.Machine, error) {
+	if machine.Labels[InitNodeLabel] == "true" {
+		return machine, nil
+	}
+	machine = machine.DeepCopy()
+	if machine.Labels == nil {
+		machine.Labels = map[string]string{}
+	}
+	machine.Labels[InitNodeLabel] = "true"
+	return p.machines.Update(machine)
+}
+
+// electInitNode returns the join URL of the init node, electing one if needed. A pinned machine always wins,
+// otherwise the current init node is kept until it is unhealthy for longer than initNodeUnhealthyTimeout and another
+// etcd machine can take over. New init nodes are preferably healthy, falling back to any etcd machine that is not
+// deleted, preferably one that joined, see fallbackInitNode.
+func (p *Planner) electInitNode(cluster *rkev1.RKECluster, currentPlan *plan.Plan) (string, error) {
+	entries, _ := collect(currentPlan, isEtcd, none)
+	pinned := pinnedInitNode(entries)
+
+	var current *planEntry
+	for i, entry := range entries {
+		if !isInitNode(entry.Machine) {
+			continue
+		}
+
+		// Clear old, duplicate or overridden init nodes
+		if entry.Machine.DeletionTimestamp != nil || current != nil || (pinned != nil && pinned.Machine.Name != entry.Machine.Name) {
+			if err := p.clearInitNodeMark(currentPlan, entry.Machine); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		current = &entries[i]
+	}
+
+	if current != nil {
+		// a machine that is drained or applying a new plan is unavailable on purpose and not unhealthy
+		if pinned != nil || initNodeCandidate(*current) || rollingOut(*current) {
+			cluster.Status.InitNode = current.Machine.Name
+			cluster.Status.InitNodeUnhealthySince = nil
+			return current.Machine.Annotations[JoinURLAnnotation], nil
+		}
+
+		if !p.initNodeTimedOut(cluster, current.Machine) {
+			return current.Machine.Annotations[JoinURLAnnotation], nil
+		}
+
+		reason := "replacing unhealthy init node " + current.Machine.Name
+		replacement := healthyInitNode(entries, current.Machine)
+		if replacement == nil {
+			reason += ", no healthy etcd machine"
+			replacement = fallbackInitNode(cluster, entries, current.Machine)
+		}
+		if replacement == nil {
+			return current.Machine.Annotations[JoinURLAnnotation], nil
+		}
+
+		if err := p.clearInitNodeMark(currentPlan, current.Machine); err != nil {
+			return "", err
+		}
+		return p.elect(cluster, currentPlan, replacement.Machine, reason)
+	}
+
+	if pinned != nil {
+		return p.elect(cluster, currentPlan, pinned.Machine, "machine is pinned")
+	}
+
+	if healthy := healthyInitNode(entries, nil); healthy != nil {
+		return p.elect(cluster, currentPlan, healthy.Machine, "machine is healthy")
+	}
+
+	if fallback := fallbackInitNode(cluster, entries, nil); fallback != nil {
+		return p.elect(cluster, currentPlan, fallback.Machine, "no healthy etcd machine")
+	}
+
+	return "", nil
+}
+
+func (p *Planner) elect(cluster *rkev1.RKECluster, currentPlan *plan.Plan, machine *capi.Machine, reason string) (string, error) {
+	machine, err := p.setInitNodeMark(machine)
+	if err != nil {
+		return "", err
+	}
+	currentPlan.Machines[machine.Name] = machine
+
+	p.recorder.Eventf(cluster, corev1.EventTypeNormal, "InitNodeElected", "Elected machine %s as init node: %s", machine.Name, reason)
+	cluster.Status.InitNode = machine.Name
+	cluster.Status.InitNodeUnhealthySince = nil
+	return machine.Annotations[JoinURLAnnotation], nil
+}
+
+// initNodeTimedOut records since when the init node is unhealthy and returns true once that exceeds the timeout
+func (p *Planner) initNodeTimedOut(cluster *rkev1.RKECluster, machine *capi.Machine) bool {
+	since := cluster.Status.InitNodeUnhealthySince
+	if since == nil || cluster.Status.InitNode != machine.Name {
+		p.recorder.Eventf(cluster, corev1.EventTypeWarning, "InitNodeUnhealthy", "Init node %s is unhealthy", machine.Name)
+		now := metav1.Now()
+		cluster.Status.InitNode = machine.Name
+		cluster.Status.InitNodeUnhealthySince = &now
+		p.rkeClusters.EnqueueAfter(cluster.Namespace, cluster.Name, initNodeUnhealthyTimeout)
+		return false
+	}
+
+	if wait := initNodeUnhealthyTimeout - time.Since(since.Time); wait > 0 {
+		p.rkeClusters.EnqueueAfter(cluster.Namespace, cluster.Name, wait)
+		return false
+	}
+
+	return true
+}
+
+func pinnedInitNode(entries []planEntry) *planEntry {
+	for i, entry := range entries {
+		if entry.Machine.Annotations[InitNodePinAnnotation] == "true" && entry.Machine.DeletionTimestamp == nil {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+func healthyInitNode(entries []planEntry, exclude *capi.Machine) *planEntry {
+	for i, entry := range entries {
+		if exclude != nil && entry.Machine.Name == exclude.Name {
+			continue
+		}
+		if initNodeCandidate(entry) {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+// fallbackInitNode returns the first etcd machine that is not deleted, preferring one that joined. Once etcd is
+// initialized only machines that joined are returned, any other machine would initialize a new etcd cluster.
+func fallbackInitNode(cluster *rkev1.RKECluster, entries []planEntry, exclude *capi.Machine) *planEntry {
+	var result *planEntry
+	for i, entry := range entries {
+		if entry.Machine.DeletionTimestamp != nil || (exclude != nil && entry.Machine.Name == exclude.Name) {
+			continue
+		}
+		if joined(entry) {
+			return &entries[i]
+		}
+		if cluster.Status.ClusterInitNode != "" {
+			continue
+		}
+		if result == nil {
+			result = &entries[i]
+		}
+	}
+	return result
+}
+
+// joined is true for machines that applied a plan and can be joined, they are members of the etcd cluster
+func joined(entry planEntry) bool {
+	return entry.Plan != nil && entry.Plan.AppliedPlan != nil && entry.Machine.Annotations[JoinURLAnnotation] != ""
+}
+
+// rollingOut is true while the machine is drained for or applying a new plan that did not fail
+func rollingOut(entry planEntry) bool {
+	if _, ok := entry.Machine.Annotations[DrainedAnnotation]; ok {
+		return true
+	}
+	return entry.Plan != nil && !entry.Plan.InSync && entry.Plan.Failures == 0
+}
+
+// adoptClusterInitNode records the machine that initialized etcd for clusters that were initialized before
+// ClusterInitNode was tracked, preferring the init node. An init node elected later then never initializes a second
+// etcd cluster. Fresh clusters record their first init node once it applied its plan.
+func adoptClusterInitNode(cluster *rkev1.RKECluster, currentPlan *plan.Plan) {
+	if cluster.Status.ClusterInitNode != "" {
+		return
+	}
+
+	entries, _ := collect(currentPlan, isEtcd, none)
+	for _, entry := range entries {
+		if entry.Plan == nil || entry.Plan.AppliedPlan == nil {
+			continue
+		}
+		if cluster.Status.ClusterInitNode == "" || isInitNode(entry.Machine) {
+			cluster.Status.ClusterInitNode = entry.Machine.Name
+		}
+	}
+}
+
+// initNodeCandidate is true for machines that applied their plan, pass their probes and can be joined
+func initNodeCandidate(entry planEntry) bool {
+	return entry.Machine.DeletionTimestamp == nil &&
+		entry.Plan != nil &&
+		available(entry.Plan) &&
+		entry.Machine.Annotations[JoinURLAnnotation] != ""
+}
@@ -0,0 +1,77 @@
+package planner
+
+import (
+	"testing"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInitNodeCandidates(t *testing.T) {
+	deleted := testMachine("etcd-a", nil)
+	deleted.DeletionTimestamp = &metav1.Time{}
+	unjoinable := testMachine("etcd-b", nil)
+	failing := testMachine("etcd-c", nil)
+	failing.Annotations = map[string]string{JoinURLAnnotation: "https://etcd-c:9345"}
+	healthy := testMachine("etcd-d", nil)
+	healthy.Annotations = map[string]string{JoinURLAnnotation: "https://etcd-d:9345"}
+
+	entries := []planEntry{
+		{Machine: deleted},
+		{Machine: unjoinable},
+		{Machine: failing, Plan: &plan.Node{InSync: true, AppliedPlan: &plan.NodePlan{}}},
+		{Machine: healthy, Plan: &plan.Node{InSync: true, Healthy: true, AppliedPlan: &plan.NodePlan{}}},
+	}
+
+	if got := healthyInitNode(entries, nil); got == nil || got.Machine != healthy {
+		t.Errorf("healthyInitNode() = %v, want %s", got, healthy.Name)
+	}
+	if got := healthyInitNode(entries, healthy); got != nil {
+		t.Errorf("healthyInitNode() excluding %s = %s, want none", healthy.Name, got.Machine.Name)
+	}
+
+	// without a healthy machine, one that joined is preferred over the first etcd machine
+	cluster := &rkev1.RKECluster{}
+	if got := fallbackInitNode(cluster, entries, healthy); got == nil || got.Machine != failing {
+		t.Errorf("fallbackInitNode() = %v, want %s", got, failing.Name)
+	}
+	if got := fallbackInitNode(cluster, entries[:2], nil); got == nil || got.Machine != unjoinable {
+		t.Errorf("fallbackInitNode() = %v, want %s", got, unjoinable.Name)
+	}
+	if got := fallbackInitNode(cluster, entries[:1], nil); got != nil {
+		t.Errorf("fallbackInitNode() elected the deleted machine %s", got.Machine.Name)
+	}
+
+	// a machine that did not join would initialize a new etcd cluster
+	cluster.Status.ClusterInitNode = "etcd-x"
+	if got := fallbackInitNode(cluster, entries, healthy); got == nil || got.Machine != failing {
+		t.Errorf("fallbackInitNode() of an initialized cluster = %v, want %s", got, failing.Name)
+	}
+	if got := fallbackInitNode(cluster, entries[:2], nil); got != nil {
+		t.Errorf("fallbackInitNode() of an initialized cluster elected %s, which did not join", got.Machine.Name)
+	}
+}
+
+func TestElectInitNodeOfInitializedCluster(t *testing.T) {
+	planner := newTestPlanner(t)
+	cluster := testCluster()
+	planner.addMachine(cluster, "machine-1", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+	planner.process(t, cluster)
+	if cluster.Status.ClusterInitNode != "machine-1" {
+		t.Fatalf("cluster init node = %q, want machine-1", cluster.Status.ClusterInitNode)
+	}
+
+	// the init node is deleted before a new etcd machine joined
+	now := metav1.Now()
+	planner.machines["machine-1"].DeletionTimestamp = &now
+	planner.addMachine(cluster, "machine-2", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+
+	status, err := planner.Process(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isInitNode(planner.machines["machine-2"]) || status.InitNode == "machine-2" {
+		t.Error("machine-2 was elected init node before it joined the initialized cluster")
+	}
+}
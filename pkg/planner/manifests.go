@@ -0,0 +1,92 @@
+package planner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+)
+
+// manifestFiles returns the additional manifest and the HelmChartConfigs of the chart values of the cluster. A file is
+// left out while there is nothing to deploy, unless the current plan of the machine has it, then it is emptied so
+// removing content from the spec also removes it from the cluster.
+func manifestFiles(cluster *rkev1.RKECluster, runtime string, current *plan.Node) ([]plan.File, error) {
+	manifests := fmt.Sprintf("/var/lib/rancher/%s/server/manifests", runtime)
+
+	chartValues, err := helmChartConfigs(cluster.Spec.ChartValues.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []plan.File
+	for path, content := range map[string][]byte{
+		manifests + "/additional-manifest.yaml": []byte(cluster.Spec.AdditionalManifest),
+		manifests + "/chart-values.yaml":        chartValues,
+	} {
+		if len(content) == 0 && !hasFile(current, path) {
+			continue
+		}
+		result = append(result, plan.File{
+			Content: base64.StdEncoding.EncodeToString(content),
+			Path:    path,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+// hasFile is true if the plan of the node writes the file
+func hasFile(node *plan.Node, path string) bool {
+	if node == nil {
+		return false
+	}
+	for _, file := range node.Plan.Files {
+		if file.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// helmChartConfigs renders a HelmChartConfig for the values of each chart, sorted by chart name
+func helmChartConfigs(chartValues map[string]interface{}) ([]byte, error) {
+	var charts []string
+	for chart := range chartValues {
+		charts = append(charts, chart)
+	}
+	sort.Strings(charts)
+
+	var docs []string
+	for _, chart := range charts {
+		values, err := json.Marshal(chartValues[chart])
+		if err != nil {
+			return nil, err
+		}
+
+		doc, err := json.Marshal(map[string]interface{}{
+			"apiVersion": "helm.cattle.io/v1",
+			"kind":       "HelmChartConfig",
+			"metadata": map[string]interface{}{
+				"name":      chart,
+				"namespace": "kube-system",
+			},
+			"spec": map[string]interface{}{
+				// JSON is valid YAML
+				"valuesContent": string(values),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, string(doc))
+	}
+
+	return []byte(strings.Join(docs, "\n---\n")), nil
+}
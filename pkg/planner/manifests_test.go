@@ -0,0 +1,57 @@
+package planner
+
+import (
+	"strings"
+	"testing"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+)
+
+func TestManifestFiles(t *testing.T) {
+	const additionalManifest = "/var/lib/rancher/k3s/server/manifests/additional-manifest.yaml"
+
+	cluster := &rkev1.RKECluster{}
+	files, err := manifestFiles(cluster, RuntimeK3S, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("a cluster without manifests writes %v", files)
+	}
+
+	cluster.Spec.AdditionalManifest = "kind: ConfigMap"
+	cluster.Spec.ChartValues = rkev1.GenericMap{Data: map[string]interface{}{"traefik": map[string]interface{}{"replicas": 2}}}
+	files, err = manifestFiles(cluster, RuntimeK3S, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Path != additionalManifest || !strings.HasSuffix(files[1].Path, "/chart-values.yaml") {
+		t.Errorf("manifestFiles() = %v, want the additional manifest and the chart values", files)
+	}
+
+	// a manifest removed from the spec is emptied rather than left behind on the machine
+	current := &plan.Node{Plan: plan.NodePlan{Files: []plan.File{{Path: additionalManifest}}}}
+	files, err = manifestFiles(&rkev1.RKECluster{}, RuntimeK3S, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != additionalManifest || files[0].Content != "" {
+		t.Errorf("manifestFiles() = %v, want the emptied additional manifest", files)
+	}
+}
+
+func TestHelmChartConfigs(t *testing.T) {
+	content, err := helmChartConfigs(map[string]interface{}{
+		"traefik":        map[string]interface{}{"replicas": 2},
+		"metrics-server": map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := strings.Split(string(content), "\n---\n")
+	if len(docs) != 2 || !strings.Contains(docs[0], `"name":"metrics-server"`) || !strings.Contains(docs[1], `"valuesContent":"{\"replicas\":2}"`) {
+		t.Errorf("helmChartConfigs() = %s", content)
+	}
+}
@@ -7,22 +7,29 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
+	"sync"
 
 	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
 	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
 	"github.com/rancher/rancher-operator/pkg/clients"
 	capicontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/cluster.x-k8s.io/v1alpha4"
 	mgmtcontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/management.cattle.io/v3"
+	rkecontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/rke.cattle.io/v1"
 	"github.com/rancher/rancher-operator/pkg/kubeconfig"
+	"github.com/rancher/rancher-operator/pkg/versions"
 	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
 	"github.com/rancher/wrangler/pkg/name"
 	"github.com/rancher/wrangler/pkg/randomtoken"
+	"github.com/rancher/wrangler/pkg/schemes"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
 )
 
@@ -46,10 +53,22 @@ const (
 var (
 	capiMachineLabel = "cluster.x-k8s.io/cluster-name"
 	ErrWaiting       = errors.New("waiting")
+	installArgs      = []string{"-c", "install.sh"}
 )
 
 type roleFilter func(machine *capi.Machine) bool
 
+// kubeconfigManager returns clients of and the server URL for downstream clusters, see kubeconfig.Manager
+type kubeconfigManager interface {
+	GetClient(clusterNamespace, clusterName string) (kubernetes.Interface, error)
+	GetServerURLAndCA() (string, string, error)
+}
+
+// versionManager looks up Kubernetes versions in the catalog, see versions.Manager
+type versionManager interface {
+	Get(kubernetesVersion string) (*versions.Version, error)
+}
+
 type Planner struct {
 	ctx                           context.Context
 	store                         *planStore
@@ -58,13 +77,24 @@ type Planner struct {
 	machines                      capicontrollers.MachineClient
 	clusterRegistrationTokenCache mgmtcontrollers.ClusterRegistrationTokenCache
 	settings                      mgmtcontrollers.SettingCache
-	kubeconfig                    *kubeconfig.Manager
+	kubeconfig                    kubeconfigManager
+	versions                      versionManager
+	etcdSnapshotCache             rkecontrollers.ETCDSnapshotCache
+	rkeClusters                   rkecontrollers.RKEClusterController
+	recorder                      record.EventRecorder
+
+	drainLock sync.Mutex
+	draining  map[string]bool
 }
 
 func New(ctx context.Context, clients *clients.Clients) *Planner {
 	clients.Management.ClusterRegistrationToken().Cache().AddIndexer(clusterRegToken, func(obj *v3.ClusterRegistrationToken) ([]string, error) {
 		return []string{obj.Spec.ClusterName}, nil
 	})
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: clients.K8s.CoreV1().Events(""),
+	})
 	return &Planner{
 		ctx: ctx,
 		store: &planStore{
@@ -78,6 +108,11 @@ func New(ctx context.Context, clients *clients.Clients) *Planner {
 		clusterRegistrationTokenCache: clients.Management.ClusterRegistrationToken().Cache(),
 		settings:                      clients.Management.Setting().Cache(),
 		kubeconfig:                    kubeconfig.New(clients),
+		versions:                      versions.New(clients),
+		etcdSnapshotCache:             clients.RKE.ETCDSnapshot().Cache(),
+		rkeClusters:                   clients.RKE.RKECluster(),
+		recorder:                      broadcaster.NewRecorder(schemes.All, corev1.EventSource{Component: "rke-planner"}),
+		draining:                      map[string]bool{},
 	}
 }
 
@@ -91,161 +126,292 @@ func (p *Planner) Process(cluster *rkev1.RKECluster) (rkev1.RKEClusterStatus, er
 		return cluster.Status, err
 	}
 
+	// readiness only depends on the plan secrets and is reported however far the rollout gets
+	cluster = cluster.DeepCopy()
+	setReadiness(cluster, plan)
+
 	cluster, secret, err := p.generateSecrets(cluster)
 	if err != nil {
 		return cluster.Status, err
 	}
 
-	if _, err := p.electInitNode(plan); err != nil {
+	cluster, version, rejected, err := p.rolloutVersion(cluster)
+	if errors.Is(err, versions.ErrUnknownVersion) || errors.Is(err, versions.ErrInvalidCatalog) {
+		KubernetesVersionValid.SetError(&cluster.Status, "", err)
+		return cluster.Status, nil
+	} else if err != nil {
 		return cluster.Status, err
 	}
+	if rejected != "" {
+		KubernetesVersionValid.SetError(&cluster.Status, "", errors.New(rejected))
+	} else {
+		KubernetesVersionValid.SetError(&cluster.Status, "", nil)
+	}
 
-	ok, err := p.reconcile(cluster, secret, plan, isInitNode, none, cluster.Spec.UpgradeStrategy.ServerConcurrency, "")
-	if err != nil || !ok {
+	startUpgrade(cluster)
+
+	if err := p.setPlanConditions(cluster, plan); err != nil {
+		return cluster.Status, err
+	}
+
+	setPlanRevision(cluster)
+	setHeldMachines(cluster, plan)
+
+	joinServer, err := p.electInitNode(cluster, plan)
+	if err != nil {
+		return cluster.Status, err
+	}
+	adoptClusterInitNode(cluster, plan)
+
+	if err := p.restoreETCDSnapshot(cluster, plan); err != nil {
+		return cluster.Status, err
+	}
+
+	setRotationProgress(cluster, "init")
+	setUpgradePhase(cluster, UpgradePhaseEtcd)
+	ok, err := p.reconcile(cluster, secret, version, plan, isInitNode, none, cluster.Spec.UpgradeStrategy.ServerConcurrency, "")
+	if err != nil || !ok || !anyMachine(plan, isInitNode) {
+		return cluster.Status, err
+	}
+
+	if cluster.Status.ClusterInitNode == "" {
+		cluster.Status.ClusterInitNode = cluster.Status.InitNode
+	}
+
+	if err := p.createETCDSnapshot(cluster, plan); err != nil {
 		return cluster.Status, err
 	}
 
-	joinServer, err := p.electInitNode(plan)
-	if err != nil || joinServer == "" {
+	if joinServer == "" {
+		// the node reporter records the join URL once the init node is up, which triggers the next run
+		return cluster.Status, nil
+	}
+
+	if err := p.rotateEncryptionKeys(cluster, secret, version, plan, joinServer); err != nil {
 		return cluster.Status, err
 	}
 
-	ok, err = p.reconcile(cluster, secret, plan, isEtcd, isInitNode, cluster.Spec.UpgradeStrategy.ServerConcurrency, joinServer)
+	setRotationProgress(cluster, "etcd")
+	setUpgradePhase(cluster, UpgradePhaseEtcd)
+	ok, err = p.reconcile(cluster, secret, version, plan, isEtcd, isInitNode, cluster.Spec.UpgradeStrategy.ServerConcurrency, joinServer)
 	if err != nil || !ok {
 		return cluster.Status, err
 	}
 
-	ok, err = p.reconcile(cluster, secret, plan, isControlPlane, isInitNode, cluster.Spec.UpgradeStrategy.ServerConcurrency, joinServer)
+	setRotationProgress(cluster, "control plane")
+	setUpgradePhase(cluster, UpgradePhaseControlPlane)
+	ok, err = p.reconcile(cluster, secret, version, plan, isControlPlane, isInitNode, cluster.Spec.UpgradeStrategy.ServerConcurrency, joinServer)
 	if err != nil || !ok {
 		return cluster.Status, err
 	}
 
-	ok, err = p.reconcile(cluster, secret, plan, isOnlyWorker, isInitNode, cluster.Spec.UpgradeStrategy.WorkerConcurrency, joinServer)
+	setRotationProgress(cluster, "worker")
+	setUpgradePhase(cluster, UpgradePhaseWorkers)
+	ok, err = p.reconcile(cluster, secret, version, plan, isOnlyWorker, isInitNode, cluster.Spec.UpgradeStrategy.WorkerConcurrency, joinServer)
 	if err != nil || !ok {
 		return cluster.Status, err
 	}
 
+	// only now every machine got its plan, a run returning at an earlier stage never saw the plans of later stages
+	PlanSizeValid.SetError(&cluster.Status, "", nil)
+	finishCertificateRotation(cluster)
+	finishUpgrade(cluster)
+	if err := p.finishJoinTokenRotation(cluster); err != nil {
+		return cluster.Status, err
+	}
+	if err := p.finishPlanSigningKeyRotation(cluster); err != nil {
+		return cluster.Status, err
+	}
+
 	return cluster.Status, err
 }
 
-func (p *Planner) CurrentPlan(cluster *rkev1.RKECluster) (*plan.Plan, error) {
-	return p.store.Load(cluster)
+// setRotationProgress records the stage of the pending certificate, join token and plan signing key rotations
+func setRotationProgress(cluster *rkev1.RKECluster, stage string) {
+	setCertificateRotationProgress(cluster, stage)
+	setJoinTokenRotationProgress(cluster, stage)
+	setPlanSigningKeyRotationProgress(cluster, stage)
 }
 
-func (p *Planner) clearInitNodeMark(machine *capi.Machine) error {
-	if _, ok := machine.Labels[InitNodeLabel]; !ok {
-		return nil
-	}
-	machine = machine.DeepCopy()
-	delete(machine.Labels, InitNodeLabel)
-	_, err := p.machines.Update(machine)
-	return err
+func (p *Planner) CurrentPlan(cluster *rkev1.RKECluster) (*plan.Plan, error) {
+	return p.store.Load(cluster)
 }
 
-func (p *Planner) setInitNodeMark(machine *capi.Machine) (*capi.Machine, error) {
-	if machine.Labels[InitNodeLabel] == "true" {
-		return machine, nil
-	}
-	machine = machine.DeepCopy()
-	if machine.Labels == nil {
-		machine.Labels = map[string]string{}
-	}
-	machine.Labels[InitNodeLabel] = "true"
-	return p.machines.Update(machine)
+func (p *Planner) reconcile(cluster *rkev1.RKECluster, secret plan.Secret, version *versions.Version, currentPlan *plan.Plan, include, exclude roleFilter, concurrency int, joinServer string) (bool, error) {
+	return p.rollout(cluster, currentPlan, include, exclude, concurrency, cluster.Status.PlanRevision, true,
+		p.planFor(cluster, secret, version, joinServer))
 }
 
-func (p *Planner) electInitNode(plan *plan.Plan) (string, error) {
-	entries, _ := collect(plan, isEtcd, none)
-	joinURL := ""
-	for _, entry := range entries {
-		if !isInitNode(entry.Machine) {
-			continue
-		}
-
-		// Clear old or misconfigured init nodes
-		if entry.Machine.DeletionTimestamp != nil || joinURL != "" {
-			if err := p.clearInitNodeMark(entry.Machine); err != nil {
-				return "", err
-			}
-			continue
+// planFor returns the plan to roll out to a machine, the plan of the spec or of the revision rolled back to
+func (p *Planner) planFor(cluster *rkev1.RKECluster, secret plan.Secret, version *versions.Version, joinServer string) func(planEntry) (plan.NodePlan, error) {
+	return func(entry planEntry) (plan.NodePlan, error) {
+		nodePlan, err := p.desiredPlan(cluster, secret, version, entry, isInitNode(entry.Machine), joinServer)
+		if err != nil {
+			return nodePlan, err
 		}
-
-		joinURL = entry.Machine.Annotations[JoinURLAnnotation]
-	}
-
-	if joinURL != "" {
-		return joinURL, nil
+		nodePlan, _, err = rollbackPlan(cluster, entry, nodePlan)
+		return nodePlan, err
 	}
-
-	if len(entries) == 0 {
-		return "", nil
-	}
-	machine, err := p.setInitNodeMark(entries[0].Machine)
-	if err != nil {
-		return "", err
-	}
-	return machine.Annotations[JoinURLAnnotation], nil
 }
 
-func (p *Planner) reconcile(cluster *rkev1.RKECluster, secret plan.Secret, plan *plan.Plan, include, exclude roleFilter, concurrency int, joinServer string) (bool, error) {
-	entries, unavailable := collect(plan, include, exclude)
+// rollout writes the plan returned by planFor to the selected machines, at most concurrency machines are unavailable
+// at a time. Held machines are left alone and nodes are only drained if drain is set. Plans are recorded with the
+// given cluster plan revision, 0 for plans that are not part of the history. Returns true once all are in sync, which
+// a selection without machines is, such as the worker stage of a cluster whose machines have all roles.
+func (p *Planner) rollout(cluster *rkev1.RKECluster, currentPlan *plan.Plan, include, exclude roleFilter, concurrency int, revision int64,
+	drain bool, planFor func(planEntry) (plan.NodePlan, error)) (bool, error) {
+	entries, unavailable := collect(currentPlan, include, exclude)
+	// machines that are up to date are left alone while another machine keeps failing to apply its plan
+	halted := len(failedMachines(cluster, currentPlan)) > 0
 
 	allInSync := true
 	for _, entry := range entries {
-		plan, err := p.desiredPlan(cluster, secret, entry, isInitNode(entry.Machine), joinServer)
+		plan, err := planFor(entry)
 		if err != nil {
 			return false, err
 		}
 
+		if held(cluster, entry.Machine) {
+			// held machines are neither drained, retried nor given a new plan
+			if entry.Plan == nil || !available(entry.Plan) || !planMatches(entry.Plan, plan) {
+				allInSync = false
+			}
+			continue
+		}
+
 		if entry.Plan == nil {
 			allInSync = false
-			if err := p.store.UpdatePlan(entry.Machine, plan); err != nil {
+			if err := p.updatePlan(cluster, entry, plan, revision); err != nil {
 				return false, err
 			}
-		} else if !equality.Semantic.DeepEqual(entry.Plan.Plan, plan) {
+		} else if !planMatches(entry.Plan, plan) {
 			allInSync = false
-			if !entry.Plan.InSync || concurrency == 0 || unavailable < concurrency {
-				if entry.Plan.InSync {
+			if keys, ok := planPublicKeysPlan(entry.Plan, plan); ok {
+				// nothing runs on the machine, it stays available and is not drained
+				if err := p.updatePlan(cluster, entry, keys, 0); err != nil {
+					return false, err
+				}
+				continue
+			}
+			if !available(entry.Plan) || (!halted && (concurrency == 0 || unavailable < concurrency)) {
+				// a plan that cannot be written is not worth draining the machine for
+				if fits, err := p.planFits(cluster, entry, plan); err != nil {
+					return false, err
+				} else if !fits {
+					continue
+				}
+				if available(entry.Plan) {
 					unavailable++
 				}
-				if err := p.store.UpdatePlan(entry.Machine, plan); err != nil {
+				if drain {
+					if drained, err := p.drain(cluster, entry, plan); err != nil {
+						return false, err
+					} else if !drained {
+						continue
+					}
+				}
+				if err := p.updatePlan(cluster, entry, plan, revision); err != nil {
 					return false, err
 				}
 			}
 		} else if !entry.Plan.InSync {
 			allInSync = false
+			if entry.Plan.Failures > 0 {
+				if err := p.retryFailedPlan(cluster, entry); err != nil {
+					return false, err
+				}
+			}
+		} else if !entry.Plan.Healthy {
+			allInSync = false
+		} else if !drain {
+			continue
+		} else if err := p.undrain(cluster, entry.Machine); err != nil {
+			return false, err
 		}
 	}
 
-	return allInSync && len(entries) > 0, nil
+	return allInSync, nil
 }
 
-func (p *Planner) desiredPlan(cluster *rkev1.RKECluster, secret plan.Secret, entry planEntry, initNode bool, joinServer string) (result plan.NodePlan, _ error) {
+// updatePlan writes the plan of the entry. A plan that does not fit into the plan secret is reported on the cluster
+// instead of being retried, it is written once it is small enough again.
+func (p *Planner) updatePlan(cluster *rkev1.RKECluster, entry planEntry, nodePlan plan.NodePlan, revision int64) error {
+	err := p.store.UpdatePlan(entry.Machine, nodePlan, revision)
+	if errors.Is(err, ErrPlanTooLarge) {
+		PlanSizeValid.SetError(&cluster.Status, "TooLarge", err)
+		return nil
+	}
+	return err
+}
+
+// planFits is false if the plan of the entry does not fit into the plan secret, which is reported on the cluster
+func (p *Planner) planFits(cluster *rkev1.RKECluster, entry planEntry, nodePlan plan.NodePlan) (bool, error) {
+	err := p.store.CheckPlanSize(entry.Machine, nodePlan)
+	if errors.Is(err, ErrPlanTooLarge) {
+		PlanSizeValid.SetError(&cluster.Status, "TooLarge", err)
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (p *Planner) desiredPlan(cluster *rkev1.RKECluster, secret plan.Secret, version *versions.Version, entry planEntry, initNode bool, joinServer string) (result plan.NodePlan, _ error) {
 	agent := false
-	config := map[string]interface{}{}
-	for _, opts := range cluster.Spec.Config {
-		sel, err := metav1.LabelSelectorAsSelector(opts.MachineLabelSelector)
+	config, err := machineConfig(cluster, version, entry.Machine)
+	if err != nil {
+		return result, err
+	}
+
+	// Everything below is computed by the planner and always overrides the user supplied config
+	for _, key := range plannerConfigKeys {
+		delete(config, key)
+	}
+
+	runtime := GetRuntime(cluster.Spec.KubernetesVersion)
+
+	if !initNode {
+		config["server"] = registrationURL(cluster, joinServer)
+	} else if runtime == RuntimeK3S && (cluster.Status.ClusterInitNode == "" || cluster.Status.ClusterInitNode == entry.Machine.Name) {
+		// rke2 initializes etcd on the first server without being told to. An init node elected after the cluster
+		// was initialized is already an etcd member and must not initialize a new cluster.
+		config["cluster-init"] = true
+	}
+
+	if isEtcd(entry.Machine) {
+		etcdConfig, files, err := p.etcdConfig(cluster, runtime)
 		if err != nil {
 			return result, err
 		}
-		if sel.Matches(labels.Set(cluster.Labels)) {
-			config = opts.Config.DeepCopy().Data
-			break
+		for k, v := range etcdConfig {
+			config[k] = v
 		}
-	}
-
-	if initNode {
-		config["cluster-init"] = true
-	} else {
-		config["server"] = joinServer
+		result.Files = append(result.Files, files...)
 	}
 
 	if isOnlyEtcd(entry.Machine) {
-		config["role"] = "etcd"
+		config["disable-apiserver"] = true
+		config["disable-controller-manager"] = true
+		config["disable-scheduler"] = true
+	} else if isOnlyControlPlane(entry.Machine) {
+		config["disable-etcd"] = true
 	} else if isOnlyWorker(entry.Machine) {
 		agent = true
 	}
 
+	registries, err := p.registriesFiles(cluster, runtime)
+	if err != nil {
+		return result, err
+	}
+	result.Files = append(result.Files, registries...)
+	result.Files = append(result.Files, planPublicKeysFiles(secret)...)
+
+	if isControlPlane(entry.Machine) {
+		manifests, err := manifestFiles(cluster, runtime, entry.Plan)
+		if err != nil {
+			return result, err
+		}
+		result.Files = append(result.Files, manifests...)
+	}
+
 	if initNode {
 		data, err := p.loadClusterAgent(cluster)
 		if err != nil {
@@ -253,22 +419,21 @@ func (p *Planner) desiredPlan(cluster *rkev1.RKECluster, secret plan.Secret, ent
 		}
 		result.Files = append(result.Files, plan.File{
 			Content: base64.StdEncoding.EncodeToString(data),
-			Path:    fmt.Sprintf("/var/lib/rancher/%s/server/manifests/cluster-agent.yaml", p.getRuntime(cluster)),
+			Path:    fmt.Sprintf("/var/lib/rancher/%s/server/manifests/cluster-agent.yaml", runtime),
 		})
 	}
 
-	instruction := plan.Instruction{
-		Image:   p.kubernetesVersionToImage(cluster.Spec.KubernetesVersion),
-		Command: "sh",
-		Args:    []string{"-c", "install.sh"},
-	}
+	instruction := installInstruction(cluster, version, agent)
 
 	if agent {
-		instruction.Args = []string{"agent"}
 		config["token"] = secret.AgentToken
 	} else {
 		config["token"] = secret.ServerToken
 		config["agent-token"] = secret.AgentToken
+		if cluster.Spec.SecretsEncryption {
+			config["secrets-encryption"] = true
+		}
+		addTLSSAN(config, cluster.Spec.RegistrationEndpoint)
 	}
 
 	var labels []string
@@ -303,7 +468,23 @@ func (p *Planner) desiredPlan(cluster *rkev1.RKECluster, secret plan.Secret, ent
 		config["node-taint"] = taintString
 	}
 
+	if !agent {
+		if rotate := rotateServerTokenInstruction(cluster, runtime, secret); rotate != nil {
+			// the bootstrap data has to be encrypted with the new token before the server restarts with it
+			result.Instructions = append(result.Instructions, *rotate)
+		}
+	}
+
 	result.Instructions = append(result.Instructions, instruction)
+	result.Probes = probes(cluster.Spec.KubernetesVersion, entry.Machine)
+
+	if rotate := rotateCertificatesInstruction(cluster, entry.Machine); rotate != nil {
+		result.Instructions = append(result.Instructions, *rotate)
+	}
+
+	if rotate := encryptionKeyRotationInstruction(cluster, entry.Machine); rotate != nil {
+		result.Instructions = append(result.Instructions, *rotate)
+	}
 
 	configData, err := json.Marshal(config)
 	if err != nil {
@@ -312,14 +493,33 @@ func (p *Planner) desiredPlan(cluster *rkev1.RKECluster, secret plan.Secret, ent
 
 	result.Files = append(result.Files, plan.File{
 		Content: base64.StdEncoding.EncodeToString(configData),
-		Path:    fmt.Sprintf("/etc/rancher/%s/config.yaml", p.getRuntime(cluster)),
+		Path:    fmt.Sprintf("/etc/rancher/%s/config.yaml", runtime),
 	})
 
 	return result, nil
 }
 
-func (p *Planner) getRuntime(cluster *rkev1.RKECluster) string {
-	return "k3s"
+// installInstruction returns the instruction running the installer image of the version, agents are installed
+// without the server components
+func installInstruction(cluster *rkev1.RKECluster, version *versions.Version, agent bool) plan.Instruction {
+	instruction := plan.Instruction{
+		Image:   version.InstallerImage,
+		Command: "sh",
+		Args:    installArgs,
+	}
+
+	runtimeEnv := GetRuntimeEnv(cluster.Spec.KubernetesVersion)
+	instruction.Env = append(instruction.Env, fmt.Sprintf("INSTALL_%s_VERSION=%s", runtimeEnv, cluster.Spec.KubernetesVersion))
+
+	if agent {
+		if GetRuntime(cluster.Spec.KubernetesVersion) == RuntimeRKE2 {
+			instruction.Env = append(instruction.Env, "INSTALL_RKE2_TYPE=agent")
+		} else {
+			instruction.Env = append(instruction.Env, fmt.Sprintf("INSTALL_%s_EXEC=agent", runtimeEnv))
+		}
+	}
+
+	return instruction
 }
 
 func (p *Planner) loadClusterAgent(cluster *rkev1.RKECluster) ([]byte, error) {
@@ -340,8 +540,53 @@ func (p *Planner) loadClusterAgent(cluster *rkev1.RKECluster) ([]byte, error) {
 	return DownloadClusterAgentYAML(p.ctx, url, ca, tokens[0].Status.Token, cluster.Spec.ManagementClusterName)
 }
 
-func (p *Planner) kubernetesVersionToImage(version string) string {
-	return "docker.io/oats87/loltgz:install-k3s"
+// rolloutVersion returns the cluster with the Kubernetes version to roll out and its catalog entry. Machines keep the
+// version they are running or upgrading to while the version of the spec is rejected, the reason is returned as well.
+// A cluster without a version rolls out the default version of the catalog, which is checked like any other version,
+// and a rollback the version of its revision. A rollback to a revision missing from the history is dropped from the
+// returned cluster.
+func (p *Planner) rolloutVersion(cluster *rkev1.RKECluster) (_ *rkev1.RKECluster, _ *versions.Version, rejected string, _ error) {
+	cluster = cluster.DeepCopy()
+	if cluster.Spec.KubernetesVersion == "" {
+		version, err := p.getVersion(cluster)
+		if err != nil {
+			return cluster, nil, "", err
+		}
+		cluster.Spec.KubernetesVersion = version.Version
+	}
+
+	var reasons []string
+	if err := rollbackVersion(cluster); err != nil {
+		reasons = append(reasons, err.Error())
+	}
+	target, err := upgradeVersion(cluster)
+	if err != nil {
+		reasons = append(reasons, err.Error())
+	}
+	cluster.Spec.KubernetesVersion = target
+
+	version, err := p.getVersion(cluster)
+	return cluster, version, strings.Join(reasons, ", "), err
+}
+
+// getVersion returns the catalog entry of the Kubernetes version of the cluster, the runtime is taken from the
+// version of the entry so the default entry of clusters without a version is checked as well
+func (p *Planner) getVersion(cluster *rkev1.RKECluster) (*versions.Version, error) {
+	version, err := p.versions.Get(cluster.Spec.KubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if runtime := GetRuntime(version.Version); !version.SupportsRuntime(runtime) {
+		return nil, fmt.Errorf("%w %q: runtime %s is not supported", versions.ErrUnknownVersion, version.Version, runtime)
+	}
+
+	return version, nil
+}
+
+// isInstallInstruction returns true for the instruction that installs the runtime
+func isInstallInstruction(instruction plan.Instruction) bool {
+	return instruction.Command == "sh" && equality.Semantic.DeepEqual(instruction.Args, installArgs)
 }
 
 func isEtcd(machine *capi.Machine) bool {
@@ -356,6 +601,10 @@ func none(machine *capi.Machine) bool {
 	return false
 }
 
+func all(machine *capi.Machine) bool {
+	return true
+}
+
 func isControlPlane(machine *capi.Machine) bool {
 	return machine.Labels[ControlPlaneRoleLabel] == "true"
 }
@@ -364,10 +613,68 @@ func isOnlyEtcd(machine *capi.Machine) bool {
 	return isEtcd(machine) && !isControlPlane(machine)
 }
 
+func isEtcdOrControlPlane(machine *capi.Machine) bool {
+	return isEtcd(machine) || isControlPlane(machine)
+}
+
+func isOnlyControlPlane(machine *capi.Machine) bool {
+	return !isEtcd(machine) && isControlPlane(machine)
+}
+
 func isOnlyWorker(machine *capi.Machine) bool {
 	return !isEtcd(machine) && !isControlPlane(machine)
 }
 
+// available is true once the node applied its plan and all probes of the plan pass, see probeHealthy
+func available(node *plan.Node) bool {
+	return node.InSync && node.Healthy
+}
+
+// oneTimeInstructions are the name prefixes of instructions that only run once, such as taking a snapshot. Once applied
+// they are dropped from the desired plan, the plan of a node still carrying them is not rolled out again for that alone.
+var oneTimeInstructions = []string{
+	"encryption-keys-",
+	"etcd-snapshot-",
+	"rotate-certificates-",
+	"rotate-server-token-",
+}
+
+func isOneTimeInstruction(instruction plan.Instruction) bool {
+	for _, prefix := range oneTimeInstructions {
+		if strings.HasPrefix(instruction.Name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// planMatches is true if the plan of the node is the desired plan or only differs by applied one time instructions.
+// A plan of nothing but one time instructions, such as taking a snapshot, runs on top of the last plan in the history
+// of the node and matches while that plan does, whether it is applied yet or not.
+func planMatches(node *plan.Node, desired plan.NodePlan) bool {
+	if equality.Semantic.DeepEqual(node.Plan, desired) {
+		return true
+	}
+
+	current := node.Plan
+	current.Instructions = withoutOneTimeInstructions(node.Plan.Instructions)
+	if len(current.Instructions) == 0 && len(node.History) > 0 {
+		current.Instructions = withoutOneTimeInstructions(node.History[len(node.History)-1].Plan.Instructions)
+	} else if !node.InSync {
+		return false
+	}
+	return equality.Semantic.DeepEqual(current, desired)
+}
+
+func withoutOneTimeInstructions(instructions []plan.Instruction) (result []plan.Instruction) {
+	for _, instruction := range instructions {
+		if !isOneTimeInstruction(instruction) {
+			result = append(result, instruction)
+		}
+	}
+	return result
+}
+
 type planEntry struct {
 	Machine *capi.Machine
 	Plan    *plan.Node
@@ -378,70 +685,127 @@ func collect(plan *plan.Plan, include, exclude func(*capi.Machine) bool) (result
 		if !include(machine) || exclude(machine) {
 			continue
 		}
+		node := plan.Nodes[name]
+		if node != nil && !available(node) {
+			unavailable++
+		}
 		result = append(result, planEntry{
 			Machine: machine,
-			Plan:    plan.Nodes[name],
+			Plan:    node,
 		})
 	}
 
 	sort.Slice(result, func(i, j int) bool {
-		if result[i].Plan != nil && !result[i].Plan.InSync {
-			unavailable++
-		}
 		return result[i].Machine.Name < result[j].Machine.Name
 	})
 
 	return result, unavailable
 }
 
+// anyMachine is true if the plan has a machine selected by include
+func anyMachine(currentPlan *plan.Plan, include roleFilter) bool {
+	entries, _ := collect(currentPlan, include, none)
+	return len(entries) > 0
+}
+
+// generateSecrets makes sure the state secret of the cluster holds the join tokens and plan signing keys to roll out
 func (p *Planner) generateSecrets(cluster *rkev1.RKECluster) (*rkev1.RKECluster, plan.Secret, error) {
-	secretName, secret, err := p.ensureRKEStateSecret(cluster)
+	secret, err := p.ensureRKEStateSecret(cluster)
 	if err != nil {
-		return nil, secret, err
+		return cluster, plan.Secret{}, err
 	}
 
 	cluster = cluster.DeepCopy()
-	cluster.Status.ClusterStateSecretName = secretName
-	return cluster, secret, nil
+	cluster.Status.ClusterStateSecretName = secret.Name
+
+	secret, err = p.ensureJoinTokens(cluster, secret)
+	if err != nil {
+		return cluster, plan.Secret{}, err
+	}
+
+	secret, err = p.ensurePlanSigningKeys(cluster, secret)
+	if err != nil {
+		return cluster, plan.Secret{}, err
+	}
+
+	result, err := planSecret(cluster, secret.Data)
+	return cluster, result, err
 }
 
-func (p *Planner) ensureRKEStateSecret(obj *rkev1.RKECluster) (string, plan.Secret, error) {
-	name := name.SafeConcatName(obj.Name, "rke", "state")
-	secret, err := p.secretCache.Get(obj.Namespace, name)
-	if apierror.IsNotFound(err) {
-		serverToken, err := randomtoken.Generate()
-		if err != nil {
-			return "", plan.Secret{}, err
-		}
+// planSecret returns the join tokens and plan public keys to roll out from the data of the state secret, the new
+// tokens while they are rotated
+func planSecret(cluster *rkev1.RKECluster, data map[string][]byte) (plan.Secret, error) {
+	result := plan.Secret{
+		ServerToken: string(data["serverToken"]),
+		AgentToken:  string(data["agentToken"]),
+	}
 
-		agentToken, err := randomtoken.Generate()
-		if err != nil {
-			return "", plan.Secret{}, err
-		}
+	if rotatingJoinTokens(cluster) && len(data["newServerToken"]) > 0 && len(data["newAgentToken"]) > 0 {
+		result.PreviousServerToken = result.ServerToken
+		result.ServerToken = string(data["newServerToken"])
+		result.AgentToken = string(data["newAgentToken"])
+	}
 
-		secret := &corev1.Secret{
+	publicKeys, err := PlanPublicKeys(data)
+	if err != nil {
+		return result, err
+	}
+	result.PlanPublicKeys = publicKeys
+	return result, nil
+}
+
+func (p *Planner) ensureRKEStateSecret(obj *rkev1.RKECluster) (*corev1.Secret, error) {
+	return EnsureStateSecret(p.secretCache, p.secretClient, obj.Namespace, obj.Name)
+}
+
+// EnsureStateSecret returns the state secret of the cluster, creating it or filling in the join tokens and the plan
+// signing key where missing. Machines are bootstrapped with the plan public key, so the machine controller makes sure
+// it exists as well instead of waiting for the planner.
+func EnsureStateSecret(secretCache corecontrollers.SecretCache, secretClient corecontrollers.SecretClient, namespace, clusterName string) (*corev1.Secret, error) {
+	secret, err := secretCache.Get(namespace, name.SafeConcatName(clusterName, "rke", "state"))
+	if apierror.IsNotFound(err) {
+		secret = &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      name,
-				Namespace: obj.Namespace,
-			},
-			Data: map[string][]byte{
-				"serverToken": []byte(serverToken),
-				"agentToken":  []byte(agentToken),
+				Name:      name.SafeConcatName(clusterName, "rke", "state"),
+				Namespace: namespace,
 			},
 			Type: "rke.cattle.io/cluster-state",
 		}
-
-		_, err = p.secretClient.Create(secret)
-		return name, plan.Secret{
-			ServerToken: serverToken,
-			AgentToken:  agentToken,
-		}, err
 	} else if err != nil {
-		return "", plan.Secret{}, err
+		return nil, err
+	}
+
+	secret = secret.DeepCopy()
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
 	}
 
-	return secret.Name, plan.Secret{
-		ServerToken: string(secret.Data["serverToken"]),
-		AgentToken:  string(secret.Data["agentToken"]),
-	}, nil
+	changed := false
+	for _, key := range []string{"serverToken", "agentToken"} {
+		if len(secret.Data[key]) > 0 {
+			continue
+		}
+		token, err := randomtoken.Generate()
+		if err != nil {
+			return nil, err
+		}
+		secret.Data[key] = []byte(token)
+		changed = true
+	}
+
+	if len(secret.Data[planSigningKey]) == 0 {
+		if secret.Data[planSigningKey], err = generatePlanSigningKey(); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+
+	switch {
+	case !changed:
+		return secret, nil
+	case secret.ResourceVersion == "":
+		return secretClient.Create(secret)
+	default:
+		return secretClient.Update(secret)
+	}
 }
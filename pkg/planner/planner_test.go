@@ -0,0 +1,124 @@
+package planner
+
+import (
+	"encoding/base64"
+	"math/rand"
+	"testing"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+func TestPlanMatches(t *testing.T) {
+	install := plan.Instruction{Command: "sh", Args: installArgs}
+	upgrade := plan.Instruction{Command: "sh", Args: installArgs, Env: []string{"INSTALL_K3S_VERSION=v1.20.5+k3s1"}}
+	snapshot := plan.Instruction{Name: "etcd-snapshot-1", Command: "k3s"}
+	restart := plan.Instruction{Name: "restart", Command: "systemctl"}
+	history := []plan.Revision{{Revision: 1, Plan: plan.NodePlan{Instructions: []plan.Instruction{install}}}}
+
+	tests := []struct {
+		name    string
+		node    plan.Node
+		desired []plan.Instruction
+		want    bool
+	}{
+		{"equal", plan.Node{Plan: plan.NodePlan{Instructions: []plan.Instruction{install}}}, []plan.Instruction{install}, true},
+		{"different", plan.Node{Plan: plan.NodePlan{Instructions: []plan.Instruction{install}}, InSync: true}, []plan.Instruction{install, restart}, false},
+		{"applied one time instruction", plan.Node{Plan: plan.NodePlan{Instructions: []plan.Instruction{install, snapshot}}, InSync: true}, []plan.Instruction{install}, true},
+		{"one time instruction not applied yet", plan.Node{Plan: plan.NodePlan{Instructions: []plan.Instruction{install, snapshot}}}, []plan.Instruction{install}, false},
+		{"new one time instruction", plan.Node{Plan: plan.NodePlan{Instructions: []plan.Instruction{install}}, InSync: true}, []plan.Instruction{install, snapshot}, false},
+		{"snapshot on top of the history", plan.Node{Plan: plan.NodePlan{Instructions: []plan.Instruction{snapshot}}, History: history}, []plan.Instruction{install}, true},
+		{"snapshot on top of an older plan", plan.Node{Plan: plan.NodePlan{Instructions: []plan.Instruction{snapshot}}, History: history}, []plan.Instruction{upgrade}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := tt.node
+			if got := planMatches(&node, plan.NodePlan{Instructions: tt.desired}); got != tt.want {
+				t.Errorf("planMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotPlan(t *testing.T) {
+	install := plan.Instruction{Command: "sh", Args: installArgs}
+	snapshot := plan.Instruction{Name: "etcd-snapshot-1", Command: "k3s"}
+	current := plan.NodePlan{
+		Files:        []plan.File{{Path: "/etc/rancher/k3s/config.yaml"}},
+		Instructions: []plan.Instruction{install},
+	}
+
+	// the snapshot runs on its own on top of the plan in the history, the runtime is not installed again
+	entry := planEntry{Plan: &plan.Node{Plan: current, History: []plan.Revision{{Revision: 1, Plan: current}}}}
+	got := snapshotPlan(entry, snapshot)
+	if !equality.Semantic.DeepEqual(got.Instructions, []plan.Instruction{snapshot}) {
+		t.Errorf("snapshot plan runs %v, want only the snapshot", got.Instructions)
+	}
+	if !equality.Semantic.DeepEqual(got.Files, current.Files) {
+		t.Errorf("snapshot plan writes %v, want the files of the current plan", got.Files)
+	}
+
+	entry.Plan.History = nil
+	got = snapshotPlan(entry, snapshot)
+	if !equality.Semantic.DeepEqual(got.Instructions, []plan.Instruction{install, snapshot}) {
+		t.Errorf("snapshot plan without history runs %v, want the current plan and the snapshot", got.Instructions)
+	}
+	if len(current.Instructions) != 1 {
+		t.Error("snapshot plan modified the current plan")
+	}
+}
+
+func TestToArgs(t *testing.T) {
+	args := toArgs(map[string]interface{}{
+		"etcd-s3":                 true,
+		"etcd-s3-skip-ssl-verify": false,
+		"etcd-s3-bucket":          "snapshots",
+		"etcd-snapshot-retention": 5,
+	})
+
+	want := []string{"--etcd-s3", "--etcd-s3-bucket=snapshots", "--etcd-snapshot-retention=5"}
+	if !equality.Semantic.DeepEqual(args, want) {
+		t.Errorf("toArgs() = %v, want %v", args, want)
+	}
+}
+
+func TestProcessPlanSizeValid(t *testing.T) {
+	planner := newTestPlanner(t)
+	cluster := testCluster()
+	planner.addMachine(cluster, "machine-1", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+	planner.addMachine(cluster, "machine-2", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+	planner.process(t, cluster)
+
+	// random data does not compress, so the config of machine-2 does not fit into its plan secret
+	large := make([]byte, maxPlanSecretSize/2)
+	rand.New(rand.NewSource(1)).Read(large)
+	cluster.Spec.Config = []rkev1.RKESystemConfig{{
+		MachineName: "machine-2",
+		Config:      rkev1.GenericMap{Data: map[string]interface{}{"node-name": base64.StdEncoding.EncodeToString(large)}},
+	}}
+	planner.process(t, cluster)
+	if !PlanSizeValid.IsFalse(&cluster.Status) {
+		t.Fatalf("plan of machine-2 is too large, plan size valid is %q", PlanSizeValid.GetStatus(&cluster.Status))
+	}
+
+	// the init node rolls out a new plan first, machine-2 is not evaluated until it is done
+	cluster.Spec.Config = append(cluster.Spec.Config, rkev1.RKESystemConfig{
+		MachineName: "machine-1",
+		Config:      rkev1.GenericMap{Data: map[string]interface{}{"node-name": "machine-1"}},
+	})
+	status, err := planner.Process(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !PlanSizeValid.IsFalse(&status) {
+		t.Error("plan size valid was reset before the plan of machine-2 was evaluated")
+	}
+
+	cluster.Spec.Config = cluster.Spec.Config[1:]
+	planner.process(t, cluster)
+	if !PlanSizeValid.IsTrue(&cluster.Status) {
+		t.Errorf("plan size valid is %q once every plan fits", PlanSizeValid.GetStatus(&cluster.Status))
+	}
+}
@@ -0,0 +1,301 @@
+package planner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/wrangler/pkg/name"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+)
+
+var (
+	// redactedConfigKeys hold credentials, as config keys or flags, only a checksum of their value is shown in a
+	// preview
+	redactedConfigKeys = map[string]bool{
+		"agent-token":        true,
+		"token":              true,
+		"new-token":          true,
+		"etcd-s3-access-key": true,
+		"etcd-s3-secret-key": true,
+	}
+	// redactedEnv hold credentials passed to instructions, only a checksum of their value is shown in a preview
+	redactedEnv = map[string]bool{
+		"AWS_ACCESS_KEY_ID":     true,
+		"AWS_SECRET_ACCESS_KEY": true,
+		"TOKEN":                 true,
+		"NEW_TOKEN":             true,
+	}
+	// redactedFiles hold credentials, only a checksum of their content is shown in a preview
+	redactedFiles = []string{
+		"/cluster-agent.yaml",
+		".key",
+	}
+)
+
+type ClusterPreview struct {
+	// Rejected is why the Kubernetes version of the spec would not be rolled out, the machines keep the version they
+	// run or upgrade to instead
+	Rejected string           `json:"rejected,omitempty"`
+	Machines []MachinePreview `json:"machines,omitempty"`
+}
+
+type MachinePreview struct {
+	Machine string `json:"machine,omitempty"`
+	// Changed is true if the machine would receive a new plan
+	Changed bool `json:"changed,omitempty"`
+	// Held is true if the machine is held or the cluster is paused, the machine keeps its plan until it is released
+	Held bool `json:"held,omitempty"`
+	// Diff is a unified diff of the decoded files and instructions of the current and the new plan
+	Diff string `json:"diff,omitempty"`
+}
+
+// Preview computes the plan of every machine of the cluster the same way Process does and compares it to the current
+// plan without writing anything. Credentials in the plans are redacted.
+func (p *Planner) Preview(cluster *rkev1.RKECluster) (*ClusterPreview, error) {
+	currentPlan, err := p.store.Load(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string][]byte{}
+	stateSecret, err := p.secretCache.Get(cluster.Namespace, name.SafeConcatName(cluster.Name, "rke", "state"))
+	if err == nil {
+		data = stateSecret.Data
+	} else if !apierror.IsNotFound(err) {
+		return nil, err
+	}
+
+	secret, err := planSecret(cluster, data)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster, version, rejected, err := p.rolloutVersion(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ClusterPreview{Rejected: rejected}
+
+	joinServer := ""
+	initNodes, _ := collect(currentPlan, isInitNode, none)
+	if len(initNodes) > 0 {
+		joinServer = initNodes[0].Machine.Annotations[JoinURLAnnotation]
+	}
+
+	// the init node is planned before any other machine has a server to join
+	initNodePlan := p.planFor(cluster, secret, version, "")
+	joinPlan := p.planFor(cluster, secret, version, joinServer)
+
+	entries, _ := collect(currentPlan, all, none)
+	for _, entry := range entries {
+		planFor := joinPlan
+		if isInitNode(entry.Machine) {
+			planFor = initNodePlan
+		}
+
+		desired, err := planFor(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		preview := MachinePreview{
+			Machine: entry.Machine.Name,
+			Held:    held(cluster, entry.Machine),
+		}
+
+		var current plan.NodePlan
+		if entry.Plan != nil {
+			if planMatches(entry.Plan, desired) {
+				result.Machines = append(result.Machines, preview)
+				continue
+			}
+			current = entry.Plan.Plan
+		}
+
+		preview.Diff, err = planDiff(current, desired)
+		if err != nil {
+			return nil, err
+		}
+		preview.Changed = preview.Diff != ""
+		result.Machines = append(result.Machines, preview)
+	}
+
+	return result, nil
+}
+
+// FormatPreview renders the preview of the cluster and of all its machines as text
+func FormatPreview(clusterPreview *ClusterPreview) string {
+	buf := &strings.Builder{}
+	if clusterPreview.Rejected != "" {
+		fmt.Fprintf(buf, "kubernetes version rejected: %s\n", clusterPreview.Rejected)
+	}
+	for _, preview := range clusterPreview.Machines {
+		switch {
+		case !preview.Changed:
+			fmt.Fprintf(buf, "machine %s: unchanged\n", preview.Machine)
+		case preview.Held:
+			fmt.Fprintf(buf, "machine %s: new plan once released\n%s\n", preview.Machine, preview.Diff)
+		default:
+			fmt.Fprintf(buf, "machine %s: new plan\n%s\n", preview.Machine, preview.Diff)
+		}
+	}
+	return buf.String()
+}
+
+func planDiff(current, desired plan.NodePlan) (string, error) {
+	currentText, err := renderPlan(current)
+	if err != nil {
+		return "", err
+	}
+	desiredText, err := renderPlan(desired)
+	if err != nil {
+		return "", err
+	}
+	if currentText == desiredText {
+		return "", nil
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(currentText),
+		B:        difflib.SplitLines(desiredText),
+		FromFile: "current",
+		ToFile:   "new",
+		Context:  3,
+	})
+}
+
+// renderPlan prints the files of the plan decoded and sorted by path, the instructions in order and the probes
+func renderPlan(nodePlan plan.NodePlan) (string, error) {
+	buf := &strings.Builder{}
+
+	files := append([]plan.File{}, nodePlan.Files...)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path+files[i].Name < files[j].Path+files[j].Name
+	})
+	for _, file := range files {
+		content, err := renderFile(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(buf, "file %s:\n%s\n", strings.TrimSuffix(file.Path+"/"+file.Name, "/"), content)
+	}
+
+	for _, instruction := range nodePlan.Instructions {
+		instruction.Args = redactArgs(instruction.Args)
+		instruction.Env = redactEnv(instruction.Env)
+		data, err := json.MarshalIndent(instruction, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(buf, "instruction %s:\n%s\n", instruction.Name, data)
+	}
+
+	var probeNames []string
+	for name := range nodePlan.Probes {
+		probeNames = append(probeNames, name)
+	}
+	sort.Strings(probeNames)
+	for _, name := range probeNames {
+		data, err := json.MarshalIndent(nodePlan.Probes[name], "", "  ")
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(buf, "probe %s:\n%s\n", name, data)
+	}
+
+	return buf.String(), nil
+}
+
+func renderFile(file plan.File) (string, error) {
+	content, err := base64.StdEncoding.DecodeString(file.Content)
+	if err != nil {
+		return "", err
+	}
+
+	for _, suffix := range redactedFiles {
+		if strings.HasSuffix(file.Path, suffix) {
+			return redact(content), nil
+		}
+	}
+
+	if strings.HasSuffix(file.Path, "/registries.yaml") {
+		return renderRegistries(content)
+	}
+
+	if !strings.HasSuffix(file.Path, "/config.yaml") {
+		return strings.TrimSuffix(string(content), "\n"), nil
+	}
+
+	config := map[string]interface{}{}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return "", err
+	}
+	for k, v := range config {
+		if redactedConfigKeys[k] {
+			config[k] = redact([]byte(fmt.Sprint(v)))
+		}
+	}
+
+	// map keys are sorted by the encoder so unchanged keys line up in the diff
+	content, err = json.MarshalIndent(config, "", "  ")
+	return string(content), err
+}
+
+// renderRegistries prints a registries.yaml with only the credentials of the registries redacted, so changes to mirrors
+// and TLS settings show up in the diff
+func renderRegistries(content []byte) (string, error) {
+	config := registries{}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return "", err
+	}
+	for _, registry := range config.Configs {
+		if auth := registry.Auth; auth != nil {
+			auth.Password = redactValue(auth.Password)
+			auth.Auth = redactValue(auth.Auth)
+			auth.IdentityToken = redactValue(auth.IdentityToken)
+		}
+	}
+
+	content, err := json.MarshalIndent(config, "", "  ")
+	return string(content), err
+}
+
+func redactValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redact([]byte(value))
+}
+
+func redactArgs(args []string) (result []string) {
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) == 2 && redactedConfigKeys[strings.TrimPrefix(parts[0], "--")] {
+			arg = parts[0] + "=" + redact([]byte(parts[1]))
+		}
+		result = append(result, arg)
+	}
+	return result
+}
+
+func redactEnv(env []string) (result []string) {
+	for _, value := range env {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) == 2 && redactedEnv[parts[0]] {
+			value = parts[0] + "=" + redact([]byte(parts[1]))
+		}
+		result = append(result, value)
+	}
+	return result
+}
+
+func redact(content []byte) string {
+	return "<redacted sha256:" + checksum(content)[:12] + ">"
+}
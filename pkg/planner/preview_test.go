@@ -0,0 +1,132 @@
+package planner
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+func TestRenderFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		content  string
+		contains []string
+		hidden   []string
+	}{
+		{
+			name:     "plain file",
+			path:     "/etc/file",
+			content:  "content\n",
+			contains: []string{"content"},
+		},
+		{
+			name:    "private key",
+			path:    "/etc/registries/tls.key",
+			content: "secret key",
+			hidden:  []string{"secret key"},
+		},
+		{
+			name:     "config credentials",
+			path:     "/etc/rancher/k3s/config.yaml",
+			content:  `{"token":"secret-token","node-name":"machine-1"}`,
+			contains: []string{"machine-1", "token"},
+			hidden:   []string{"secret-token"},
+		},
+		{
+			name:     "registry credentials",
+			path:     "/etc/rancher/k3s/registries.yaml",
+			content:  `{"mirrors":{"docker.io":{"endpoint":["https://mirror.example.com"]}},"configs":{"mirror.example.com":{"auth":{"username":"user","password":"secret-password"}}}}`,
+			contains: []string{"https://mirror.example.com", "user"},
+			hidden:   []string{"secret-password"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderFile(plan.File{
+				Path:    tt.path,
+				Content: base64.StdEncoding.EncodeToString([]byte(tt.content)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, value := range tt.contains {
+				if !strings.Contains(got, value) {
+					t.Errorf("renderFile() = %q, want it to contain %q", got, value)
+				}
+			}
+			for _, value := range tt.hidden {
+				if strings.Contains(got, value) {
+					t.Errorf("renderFile() = %q, want %q redacted", got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactArgsAndEnv(t *testing.T) {
+	args := redactArgs([]string{"--token=secret", "--name=snapshot", "--debug"})
+	if args[0] != "--token="+redact([]byte("secret")) {
+		t.Errorf("token arg not redacted: %s", args[0])
+	}
+	if !equality.Semantic.DeepEqual(args[1:], []string{"--name=snapshot", "--debug"}) {
+		t.Errorf("other args changed: %v", args[1:])
+	}
+
+	env := redactEnv([]string{"AWS_SECRET_ACCESS_KEY=secret", "INSTALL_K3S_VERSION=v1.20.4+k3s1"})
+	if env[0] != "AWS_SECRET_ACCESS_KEY="+redact([]byte("secret")) {
+		t.Errorf("secret env not redacted: %s", env[0])
+	}
+	if env[1] != "INSTALL_K3S_VERSION=v1.20.4+k3s1" {
+		t.Errorf("other env changed: %s", env[1])
+	}
+}
+
+func TestPlanDiff(t *testing.T) {
+	current := plan.NodePlan{
+		Files: []plan.File{{Path: "/etc/file", Content: base64.StdEncoding.EncodeToString([]byte("old"))}},
+	}
+	desired := plan.NodePlan{
+		Files: []plan.File{{Path: "/etc/file", Content: base64.StdEncoding.EncodeToString([]byte("new"))}},
+	}
+
+	diff, err := planDiff(current, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != "" {
+		t.Errorf("planDiff() of equal plans = %q, want none", diff)
+	}
+
+	diff, err = planDiff(current, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "-old") || !strings.Contains(diff, "+new") {
+		t.Errorf("planDiff() = %q, want the changed content", diff)
+	}
+}
+
+func TestFormatPreview(t *testing.T) {
+	text := FormatPreview(&ClusterPreview{
+		Rejected: "downgrade from v1.20.4+k3s1 to v1.19.8+k3s1 is not supported",
+		Machines: []MachinePreview{
+			{Machine: "machine-1"},
+			{Machine: "machine-2", Changed: true, Held: true, Diff: "+new"},
+		},
+	})
+
+	for _, line := range []string{
+		"kubernetes version rejected: downgrade from v1.20.4+k3s1 to v1.19.8+k3s1 is not supported",
+		"machine machine-1: unchanged",
+		"machine machine-2: new plan once released",
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("FormatPreview() = %q, want the line %q", text, line)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package planner
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+// probes returns the health checks of the components the Kubernetes version runs on the machine
+func probes(kubernetesVersion string, machine *capi.Machine) map[string]plan.Probe {
+	result := map[string]plan.Probe{
+		"kubelet": probe(plan.HTTPGetAction{
+			URL: "http://127.0.0.1:10248/healthz",
+		}),
+	}
+
+	if isControlPlane(machine) {
+		tls := fmt.Sprintf("/var/lib/rancher/%s/server/tls", GetRuntime(kubernetesVersion))
+		result["kube-apiserver"] = probe(plan.HTTPGetAction{
+			URL:        fmt.Sprintf("https://127.0.0.1:%d/readyz", GetRuntimeAPIServerPort(kubernetesVersion)),
+			CACert:     tls + "/server-ca.crt",
+			ClientCert: tls + "/client-kube-apiserver.crt",
+			ClientKey:  tls + "/client-kube-apiserver.key",
+		})
+	}
+
+	if isEtcd(machine) {
+		result["etcd"] = probe(plan.HTTPGetAction{
+			URL: "http://127.0.0.1:2381/health",
+		})
+	}
+
+	return result
+}
+
+func probe(action plan.HTTPGetAction) plan.Probe {
+	return plan.Probe{
+		InitialDelaySeconds: 1,
+		TimeoutSeconds:      5,
+		SuccessThreshold:    1,
+		FailureThreshold:    2,
+		HTTPGetAction:       action,
+	}
+}
+
+// probeHealthy is true if the node applied its plan and the probe passes. Agents that report no probe statuses at
+// all, such as agents without probe support, are trusted once they applied their plan.
+func probeHealthy(node *plan.Node, name string) bool {
+	if node == nil || node.AppliedPlan == nil {
+		return false
+	}
+	if len(node.ProbeStatus) == 0 {
+		return true
+	}
+	return node.ProbeStatus[name].Healthy
+}
+
+// failingProbes returns the sorted names of the probes of the plan that are not reported healthy, none if the agent
+// reports no probe statuses
+func failingProbes(nodePlan *plan.NodePlan, status map[string]plan.ProbeStatus) (result []string) {
+	if len(status) == 0 {
+		return nil
+	}
+	for name := range nodePlan.Probes {
+		if !status[name].Healthy {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
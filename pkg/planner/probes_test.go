@@ -0,0 +1,71 @@
+package planner
+
+import (
+	"testing"
+
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+func TestProbes(t *testing.T) {
+	server := testMachine("server", map[string]string{ControlPlaneRoleLabel: "true", EtcdRoleLabel: "true"})
+
+	result := probes("v1.20.4+rke2r1", server)
+	apiserver := result["kube-apiserver"].HTTPGetAction
+	if apiserver.URL != "https://127.0.0.1:6443/readyz" {
+		t.Errorf("kube-apiserver is probed at %s", apiserver.URL)
+	}
+	if apiserver.CACert != "/var/lib/rancher/rke2/server/tls/server-ca.crt" {
+		t.Errorf("kube-apiserver is probed with the CA %s", apiserver.CACert)
+	}
+	if _, ok := result["etcd"]; !ok {
+		t.Error("etcd is not probed on an etcd machine")
+	}
+
+	result = probes("v1.20.4+k3s1", testMachine("worker", nil))
+	if len(result) != 1 || result["kubelet"].HTTPGetAction.URL == "" {
+		t.Errorf("workers are probed with %v, want only the kubelet", result)
+	}
+}
+
+func TestFailingProbes(t *testing.T) {
+	nodePlan := &plan.NodePlan{
+		Probes: map[string]plan.Probe{
+			"kubelet": {},
+			"etcd":    {},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		status map[string]plan.ProbeStatus
+		want   []string
+	}{
+		{"no statuses reported", nil, nil},
+		{"all healthy", map[string]plan.ProbeStatus{"kubelet": {Healthy: true}, "etcd": {Healthy: true}}, nil},
+		{"failing", map[string]plan.ProbeStatus{"kubelet": {Healthy: true}, "etcd": {}}, []string{"etcd"}},
+		{"missing status", map[string]plan.ProbeStatus{"kubelet": {Healthy: true}}, []string{"etcd"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := failingProbes(nodePlan, tt.status); !equality.Semantic.DeepEqual(got, tt.want) {
+				t.Errorf("failingProbes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeHealthy(t *testing.T) {
+	applied := &plan.NodePlan{}
+
+	if probeHealthy(&plan.Node{}, "etcd") {
+		t.Error("a node that did not apply its plan is healthy")
+	}
+	if !probeHealthy(&plan.Node{AppliedPlan: applied}, "etcd") {
+		t.Error("an agent that reports no probe statuses is not trusted")
+	}
+	if probeHealthy(&plan.Node{AppliedPlan: applied, ProbeStatus: map[string]plan.ProbeStatus{"kubelet": {Healthy: true}}}, "etcd") {
+		t.Error("a probe the agent does not report is healthy")
+	}
+}
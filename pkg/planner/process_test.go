@@ -0,0 +1,282 @@
+package planner
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	capicontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/cluster.x-k8s.io/v1alpha4"
+	mgmtcontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/management.cattle.io/v3"
+	rkecontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/versions"
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+// testPlanner runs the planner against in-memory secrets and machines. The embedded interfaces are nil, calling a
+// method the fakes do not implement panics and shows that the test needs more of the fake.
+type testPlanner struct {
+	*Planner
+	secrets  map[string]*corev1.Secret
+	machines map[string]*capi.Machine
+	// installs counts the plans applied to each machine that run the installer
+	installs map[string]int
+}
+
+type fakeSecrets struct {
+	corecontrollers.SecretClient
+	t *testPlanner
+}
+
+func (f fakeSecrets) Create(secret *corev1.Secret) (*corev1.Secret, error) {
+	f.t.secrets[secret.Namespace+"/"+secret.Name] = secret.DeepCopy()
+	return secret, nil
+}
+
+func (f fakeSecrets) Update(secret *corev1.Secret) (*corev1.Secret, error) {
+	return f.Create(secret)
+}
+
+func (f fakeSecrets) Get(namespace, name string, _ metav1.GetOptions) (*corev1.Secret, error) {
+	secret, ok := f.t.secrets[namespace+"/"+name]
+	if !ok {
+		return nil, apierror.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+	}
+	return secret.DeepCopy(), nil
+}
+
+type fakeSecretCache struct {
+	corecontrollers.SecretCache
+	t *testPlanner
+}
+
+func (f fakeSecretCache) Get(namespace, name string) (*corev1.Secret, error) {
+	return fakeSecrets{t: f.t}.Get(namespace, name, metav1.GetOptions{})
+}
+
+type fakeMachines struct {
+	capicontrollers.MachineClient
+	t *testPlanner
+}
+
+func (f fakeMachines) Update(machine *capi.Machine) (*capi.Machine, error) {
+	f.t.machines[machine.Name] = machine.DeepCopy()
+	return machine, nil
+}
+
+func (f fakeMachines) UpdateStatus(machine *capi.Machine) (*capi.Machine, error) {
+	return f.Update(machine)
+}
+
+func (f fakeMachines) Get(_, name string, _ metav1.GetOptions) (*capi.Machine, error) {
+	return f.t.machines[name].DeepCopy(), nil
+}
+
+type fakeMachineCache struct {
+	capicontrollers.MachineCache
+	t *testPlanner
+}
+
+func (f fakeMachineCache) List(_ string, selector labels.Selector) (result []*capi.Machine, _ error) {
+	for _, machine := range f.t.machines {
+		if selector.Matches(labels.Set(machine.Labels)) {
+			result = append(result, machine.DeepCopy())
+		}
+	}
+	return result, nil
+}
+
+type fakeTokens struct {
+	mgmtcontrollers.ClusterRegistrationTokenCache
+}
+
+func (fakeTokens) GetByIndex(_, _ string) ([]*v3.ClusterRegistrationToken, error) {
+	return []*v3.ClusterRegistrationToken{{Status: v3.ClusterRegistrationTokenStatus{Token: "token"}}}, nil
+}
+
+type fakeRKEClusters struct {
+	rkecontrollers.RKEClusterController
+}
+
+func (fakeRKEClusters) EnqueueAfter(_, _ string, _ time.Duration) {}
+
+// fakeRancher serves the cluster agent manifest of the init node and the client of the downstream cluster
+type fakeRancher struct {
+	server *httptest.Server
+	client kubernetes.Interface
+}
+
+func (f fakeRancher) GetClient(_, _ string) (kubernetes.Interface, error) {
+	if f.client == nil {
+		panic("machines without a node are not drained")
+	}
+	return f.client, nil
+}
+
+func (f fakeRancher) GetServerURLAndCA() (string, string, error) {
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.server.Certificate().Raw})
+	return f.server.URL, string(ca), nil
+}
+
+type fakeVersions struct{}
+
+func (fakeVersions) Get(kubernetesVersion string) (*versions.Version, error) {
+	return &versions.Version{Version: kubernetesVersion, InstallerImage: "installer"}, nil
+}
+
+func newTestPlanner(t *testing.T) *testPlanner {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		_, _ = rw.Write([]byte("kind: List"))
+	}))
+	t.Cleanup(server.Close)
+
+	result := &testPlanner{
+		secrets:  map[string]*corev1.Secret{},
+		machines: map[string]*capi.Machine{},
+		installs: map[string]int{},
+	}
+	result.Planner = &Planner{
+		ctx: context.Background(),
+		store: &planStore{
+			secrets:      fakeSecrets{t: result},
+			secretsCache: fakeSecretCache{t: result},
+			machineCache: fakeMachineCache{t: result},
+		},
+		secretClient:                  fakeSecrets{t: result},
+		secretCache:                   fakeSecretCache{t: result},
+		machines:                      fakeMachines{t: result},
+		clusterRegistrationTokenCache: fakeTokens{},
+		kubeconfig:                    fakeRancher{server: server},
+		versions:                      fakeVersions{},
+		rkeClusters:                   fakeRKEClusters{},
+		recorder:                      record.NewFakeRecorder(100),
+		draining:                      map[string]bool{},
+	}
+	return result
+}
+
+// addMachine adds a machine of the cluster with the given role labels and an empty plan secret
+func (t *testPlanner) addMachine(cluster *rkev1.RKECluster, name string, roles ...string) {
+	machine := testMachine(name, map[string]string{capiMachineLabel: cluster.Name})
+	machine.Namespace = cluster.Namespace
+	machine.UID = types.UID(name)
+	for _, role := range roles {
+		machine.Labels[role] = "true"
+	}
+	t.machines[name] = machine
+
+	secret := &corev1.Secret{}
+	secret.Namespace = cluster.Namespace
+	secret.Name = PlanSecretFromMachine(machine)
+	t.secrets[secret.Namespace+"/"+secret.Name] = secret
+}
+
+// applyPlans acts as the agents and node reporters of all machines: plans are applied and every machine can be joined
+func (t *testPlanner) applyPlans(tt *testing.T) {
+	for _, machine := range t.machines {
+		secret := t.secrets[machine.Namespace+"/"+PlanSecretFromMachine(machine)]
+		if len(secret.Data["plan"]) > 0 && !bytes.Equal(secret.Data["plan"], secret.Data["appliedPlan"]) {
+			for _, instruction := range t.plan(tt, machine.Name).Instructions {
+				if isInstallInstruction(instruction) {
+					t.installs[machine.Name]++
+				}
+			}
+			if err := RecordAppliedPlan(secret); err != nil {
+				tt.Fatal(err)
+			}
+		}
+		if machine.Annotations == nil {
+			machine.Annotations = map[string]string{}
+		}
+		machine.Annotations[JoinURLAnnotation] = "https://" + machine.Name + ":6443"
+	}
+}
+
+// process runs the planner and the agents often enough for a small cluster to roll out, the status of the last run
+// is kept on the cluster
+func (t *testPlanner) process(tt *testing.T, cluster *rkev1.RKECluster) {
+	for i := 0; i < 10; i++ {
+		t.step(tt, cluster)
+	}
+}
+
+// step runs the planner once and then the agents, the status is kept on the cluster. Waiting is not an error, like
+// in the planner controller.
+func (t *testPlanner) step(tt *testing.T, cluster *rkev1.RKECluster) {
+	status, err := t.Process(cluster)
+	if err != nil && !errors.Is(err, ErrWaiting) {
+		tt.Fatal(err)
+	}
+	cluster.Status = status
+	t.applyPlans(tt)
+}
+
+func testCluster() *rkev1.RKECluster {
+	cluster := &rkev1.RKECluster{}
+	cluster.Namespace = "fleet-default"
+	cluster.Name = "test"
+	cluster.Spec.KubernetesVersion = "v1.20.4+k3s1"
+	return cluster
+}
+
+func TestProcessAllRolesCluster(t *testing.T) {
+	planner := newTestPlanner(t)
+	cluster := testCluster()
+	planner.addMachine(cluster, "machine-1", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+	planner.addMachine(cluster, "machine-2", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+
+	planner.process(t, cluster)
+	if cluster.Status.KubernetesVersion != "v1.20.4+k3s1" {
+		t.Fatalf("rollout of a cluster without worker-only machines did not finish, version is %q", cluster.Status.KubernetesVersion)
+	}
+
+	// the version is known now, so a downgrade is rejected
+	cluster.Spec.KubernetesVersion = "v1.19.8+k3s1"
+	planner.process(t, cluster)
+	if !KubernetesVersionValid.IsFalse(&cluster.Status) || cluster.Status.KubernetesVersion != "v1.20.4+k3s1" {
+		t.Errorf("downgrade was not rejected: %+v", cluster.Status)
+	}
+
+	cluster.Spec.KubernetesVersion = "v1.20.5+k3s1"
+	planner.process(t, cluster)
+	if cluster.Status.KubernetesVersion != "v1.20.5+k3s1" || cluster.Status.UpgradePhase != UpgradePhaseDone {
+		t.Errorf("upgrade did not finish: version %q, phase %q", cluster.Status.KubernetesVersion, cluster.Status.UpgradePhase)
+	}
+}
+
+// plan returns the plan last written to the machine
+func (t *testPlanner) plan(tt *testing.T, machineName string) plan.NodePlan {
+	machine := t.machines[machineName]
+	nodePlan, err := unmarshalPlan(t.secrets[machine.Namespace+"/"+PlanSecretFromMachine(machine)].Data["plan"])
+	if err != nil {
+		tt.Fatal(err)
+	}
+	return nodePlan
+}
+
+// hasInstruction is true if the plan runs an instruction with the given name prefix
+func hasInstruction(nodePlan plan.NodePlan, prefix string) bool {
+	for _, instruction := range nodePlan.Instructions {
+		if strings.HasPrefix(instruction.Name, prefix) {
+			return true
+		}
+	}
+	return false
+}
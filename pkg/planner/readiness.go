@@ -0,0 +1,78 @@
+package planner
+
+import (
+	"fmt"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/wrangler/pkg/condition"
+)
+
+// setReadiness reports the progress of the machines of the cluster. The cluster is ready once an init node is elected,
+// every etcd and control plane machine applied its plan and passes its probes, if its agent reports them, and the
+// Kubernetes API is reachable on a control plane machine.
+func setReadiness(cluster *rkev1.RKECluster, currentPlan *plan.Plan) {
+	var (
+		total, provisioned, updated       int
+		etcd, etcdHealthy                 int
+		controlPlane, controlPlaneReady   int
+		serversAvailable, serversExpected int
+	)
+
+	for name, machine := range currentPlan.Machines {
+		node := currentPlan.Nodes[name]
+		applied := node != nil && node.AppliedPlan != nil
+
+		total++
+		if applied {
+			provisioned++
+		}
+		if node != nil && available(node) {
+			updated++
+		}
+
+		if isEtcd(machine) {
+			etcd++
+			if probeHealthy(node, "etcd") {
+				etcdHealthy++
+			}
+		}
+		if isControlPlane(machine) {
+			controlPlane++
+			if probeHealthy(node, "kube-apiserver") {
+				controlPlaneReady++
+			}
+		}
+		if isEtcdOrControlPlane(machine) {
+			serversExpected++
+			if node != nil && available(node) {
+				serversAvailable++
+			}
+		}
+	}
+
+	setCount(cluster, Provisioned, total > 0 && provisioned == total, "Provisioning",
+		fmt.Sprintf("%d/%d machines provisioned", provisioned, total))
+	setCount(cluster, Updated, total > 0 && updated == total, "Updating",
+		fmt.Sprintf("%d/%d machines up to date", updated, total))
+	setCount(cluster, EtcdHealthy, etcd > 0 && etcdHealthy > etcd/2, "NoQuorum",
+		fmt.Sprintf("%d/%d etcd machines healthy", etcdHealthy, etcd))
+	setCount(cluster, ControlPlaneReady, controlPlaneReady > 0, "Unavailable",
+		fmt.Sprintf("%d/%d control plane machines ready", controlPlaneReady, controlPlane))
+
+	cluster.Status.Ready = cluster.Status.InitNode != "" &&
+		serversExpected > 0 &&
+		serversAvailable == serversExpected &&
+		controlPlaneReady > 0
+}
+
+func setCount(cluster *rkev1.RKECluster, cond condition.Cond, ok bool, reason, message string) {
+	if ok {
+		cond.True(&cluster.Status)
+		cond.Reason(&cluster.Status, "")
+	} else {
+		cond.False(&cluster.Status)
+		cond.Reason(&cluster.Status, reason)
+	}
+	cond.Message(&cluster.Status, message)
+}
@@ -0,0 +1,106 @@
+package planner
+
+import (
+	"testing"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/wrangler/pkg/condition"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+func TestSetReadiness(t *testing.T) {
+	ready := func() *plan.Node {
+		return &plan.Node{AppliedPlan: &plan.NodePlan{}, InSync: true, Healthy: true}
+	}
+	type count struct {
+		status, reason, message string
+	}
+
+	tests := []struct {
+		name     string
+		initNode string
+		nodes    map[string]*plan.Node
+		want     map[condition.Cond]count
+		ready    bool
+	}{
+		{
+			name:     "all machines ready",
+			initNode: "machine-1",
+			nodes:    map[string]*plan.Node{"machine-1": ready(), "machine-2": ready(), "machine-3": ready()},
+			want: map[condition.Cond]count{
+				Provisioned:       {"True", "", "3/3 machines provisioned"},
+				Updated:           {"True", "", "3/3 machines up to date"},
+				EtcdHealthy:       {"True", "", "2/2 etcd machines healthy"},
+				ControlPlaneReady: {"True", "", "1/1 control plane machines ready"},
+			},
+			ready: true,
+		},
+		{
+			name:     "partially ready",
+			initNode: "machine-1",
+			nodes: map[string]*plan.Node{
+				"machine-1": ready(),
+				"machine-3": {AppliedPlan: &plan.NodePlan{}, Healthy: true},
+			},
+			want: map[condition.Cond]count{
+				Provisioned:       {"False", "Provisioning", "2/3 machines provisioned"},
+				Updated:           {"False", "Updating", "1/3 machines up to date"},
+				EtcdHealthy:       {"False", "NoQuorum", "1/2 etcd machines healthy"},
+				ControlPlaneReady: {"True", "", "1/1 control plane machines ready"},
+			},
+		},
+		{
+			name:     "API server probe failing",
+			initNode: "machine-1",
+			nodes: map[string]*plan.Node{
+				"machine-1": {AppliedPlan: &plan.NodePlan{}, InSync: true, ProbeStatus: map[string]plan.ProbeStatus{
+					"etcd":           {Healthy: true},
+					"kube-apiserver": {FailureCount: 3},
+				}},
+				"machine-2": ready(),
+				"machine-3": ready(),
+			},
+			want: map[condition.Cond]count{
+				Provisioned:       {"True", "", "3/3 machines provisioned"},
+				Updated:           {"False", "Updating", "2/3 machines up to date"},
+				EtcdHealthy:       {"True", "", "2/2 etcd machines healthy"},
+				ControlPlaneReady: {"False", "Unavailable", "0/1 control plane machines ready"},
+			},
+		},
+		{
+			name:  "no init node elected",
+			nodes: map[string]*plan.Node{"machine-1": ready(), "machine-2": ready(), "machine-3": ready()},
+			want: map[condition.Cond]count{
+				Provisioned:       {"True", "", "3/3 machines provisioned"},
+				ControlPlaneReady: {"True", "", "1/1 control plane machines ready"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &rkev1.RKECluster{}
+			cluster.Status.InitNode = tt.initNode
+			currentPlan := &plan.Plan{
+				Machines: map[string]*capi.Machine{
+					"machine-1": testMachine("machine-1", map[string]string{EtcdRoleLabel: "true", ControlPlaneRoleLabel: "true"}),
+					"machine-2": testMachine("machine-2", map[string]string{EtcdRoleLabel: "true"}),
+					"machine-3": testMachine("machine-3", map[string]string{WorkerRoleLabel: "true"}),
+				},
+				Nodes: tt.nodes,
+			}
+
+			setReadiness(cluster, currentPlan)
+			for cond, want := range tt.want {
+				got := count{cond.GetStatus(&cluster.Status), cond.GetReason(&cluster.Status), cond.GetMessage(&cluster.Status)}
+				if got != want {
+					t.Errorf("%s = %+v, want %+v", cond, got, want)
+				}
+			}
+			if cluster.Status.Ready != tt.ready {
+				t.Errorf("ready = %v, want %v", cluster.Status.Ready, tt.ready)
+			}
+		})
+	}
+}
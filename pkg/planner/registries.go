@@ -0,0 +1,148 @@
+package planner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// registries and the types below follow the registries.yaml format of k3s and rke2
+type registries struct {
+	Mirrors map[string]mirror         `json:"mirrors,omitempty"`
+	Configs map[string]registryConfig `json:"configs,omitempty"`
+}
+
+type mirror struct {
+	Endpoints []string `json:"endpoint,omitempty"`
+}
+
+type registryConfig struct {
+	Auth *registryAuth `json:"auth,omitempty"`
+	TLS  *registryTLS  `json:"tls,omitempty"`
+}
+
+type registryAuth struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	Auth          string `json:"auth,omitempty"`
+	IdentityToken string `json:"identity_token,omitempty"`
+}
+
+type registryTLS struct {
+	CertFile           string `json:"cert_file,omitempty"`
+	KeyFile            string `json:"key_file,omitempty"`
+	CAFile             string `json:"ca_file,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// registriesFiles renders the registries of the cluster to the registries.yaml of the runtime and the TLS files it
+// references. Credentials are read from secrets so changing them rolls out a new plan.
+func (p *Planner) registriesFiles(cluster *rkev1.RKECluster, runtime string) ([]plan.File, error) {
+	spec := cluster.Spec.Registries
+	if spec == nil {
+		return nil, nil
+	}
+
+	var (
+		files  []plan.File
+		result = registries{
+			Mirrors: map[string]mirror{},
+			Configs: map[string]registryConfig{},
+		}
+	)
+
+	for name, m := range spec.Mirrors {
+		result.Mirrors[name] = mirror{
+			Endpoints: m.Endpoints,
+		}
+	}
+
+	// sorted so the files of the plan are stable
+	var hosts []string
+	for host := range spec.Configs {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		config := spec.Configs[host]
+		dir := fmt.Sprintf("/etc/rancher/%s/registries/%s", runtime, strings.NewReplacer(":", "_", "/", "_").Replace(host))
+		registry := registryConfig{}
+
+		if config.AuthConfigSecretName != "" {
+			secret, err := p.secretCache.Get(cluster.Namespace, config.AuthConfigSecretName)
+			if err != nil {
+				return nil, err
+			}
+			registry.Auth = &registryAuth{
+				Username:      string(secret.Data["username"]),
+				Password:      string(secret.Data["password"]),
+				Auth:          string(secret.Data["auth"]),
+				IdentityToken: string(secret.Data["identityToken"]),
+			}
+		}
+
+		if config.TLSSecretName != "" || config.CABundle != "" || config.InsecureSkipVerify {
+			registry.TLS = &registryTLS{
+				InsecureSkipVerify: config.InsecureSkipVerify,
+			}
+		}
+
+		if config.TLSSecretName != "" {
+			secret, err := p.secretCache.Get(cluster.Namespace, config.TLSSecretName)
+			if err != nil {
+				return nil, err
+			}
+			registry.TLS.CertFile = dir + "/tls.crt"
+			registry.TLS.KeyFile = dir + "/tls.key"
+			files = append(files,
+				registryFile(registry.TLS.CertFile, secret.Data[corev1.TLSCertKey]),
+				registryFile(registry.TLS.KeyFile, secret.Data[corev1.TLSPrivateKeyKey]))
+		}
+
+		if config.CABundle != "" {
+			registry.TLS.CAFile = dir + "/ca.crt"
+			files = append(files, registryFile(registry.TLS.CAFile, []byte(config.CABundle)))
+		}
+
+		result.Configs[host] = registry
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(files, registryFile(fmt.Sprintf("/etc/rancher/%s/registries.yaml", runtime), data)), nil
+}
+
+func registryFile(path string, content []byte) plan.File {
+	return plan.File{
+		Content: base64.StdEncoding.EncodeToString(content),
+		Path:    path,
+	}
+}
+
+// ReferencedSecrets returns the names of the secrets in the namespace of the cluster its plans are rendered from
+func ReferencedSecrets(cluster *rkev1.RKECluster) (result []string) {
+	if etcd := cluster.Spec.ETCD; etcd != nil && etcd.S3 != nil && etcd.S3.CredentialSecretName != "" {
+		result = append(result, etcd.S3.CredentialSecretName)
+	}
+	if cluster.Spec.Registries != nil {
+		for _, config := range cluster.Spec.Registries.Configs {
+			if config.AuthConfigSecretName != "" {
+				result = append(result, config.AuthConfigSecretName)
+			}
+			if config.TLSSecretName != "" {
+				result = append(result, config.TLSSecretName)
+			}
+		}
+	}
+	return result
+}
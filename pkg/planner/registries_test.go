@@ -0,0 +1,126 @@
+package planner
+
+import (
+	"encoding/base64"
+	"testing"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestRegistriesFiles(t *testing.T) {
+	const (
+		registriesPath = "/etc/rancher/k3s/registries.yaml"
+		certsDir       = "/etc/rancher/k3s/registries/registry.example.com_5000"
+	)
+
+	tests := []struct {
+		name       string
+		registries *rkev1.Registry
+		want       map[string]string
+	}{
+		{
+			name: "no registries",
+		},
+		{
+			name: "mirrors",
+			registries: &rkev1.Registry{
+				Mirrors: map[string]rkev1.Mirror{
+					"docker.io": {Endpoints: []string{"https://mirror.example.com"}},
+				},
+			},
+			want: map[string]string{
+				registriesPath: `{"mirrors":{"docker.io":{"endpoint":["https://mirror.example.com"]}}}`,
+			},
+		},
+		{
+			name: "credentials from secret",
+			registries: &rkev1.Registry{
+				Configs: map[string]rkev1.RegistryConfig{
+					"registry.example.com:5000": {AuthConfigSecretName: "registry-auth"},
+				},
+			},
+			want: map[string]string{
+				registriesPath: `{"configs":{"registry.example.com:5000":{"auth":{"username":"user","password":"secret"}}}}`,
+			},
+		},
+		{
+			name: "TLS files",
+			registries: &rkev1.Registry{
+				Configs: map[string]rkev1.RegistryConfig{
+					"registry.example.com:5000": {TLSSecretName: "registry-tls", CABundle: "ca"},
+				},
+			},
+			want: map[string]string{
+				certsDir + "/tls.crt": "cert",
+				certsDir + "/tls.key": "key",
+				certsDir + "/ca.crt":  "ca",
+				registriesPath: `{"configs":{"registry.example.com:5000":{"tls":{"cert_file":"` + certsDir + `/tls.crt",` +
+					`"key_file":"` + certsDir + `/tls.key","ca_file":"` + certsDir + `/ca.crt"}}}}`,
+			},
+		},
+		{
+			name: "insecure registry",
+			registries: &rkev1.Registry{
+				Configs: map[string]rkev1.RegistryConfig{
+					"registry.example.com:5000": {InsecureSkipVerify: true},
+				},
+			},
+			want: map[string]string{
+				registriesPath: `{"configs":{"registry.example.com:5000":{"tls":{"insecure_skip_verify":true}}}}`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planner := newTestPlanner(t)
+			cluster := testCluster()
+			cluster.Spec.Registries = tt.registries
+			planner.secrets[cluster.Namespace+"/registry-auth"] = &corev1.Secret{Data: map[string][]byte{
+				"username": []byte("user"),
+				"password": []byte("secret"),
+			}}
+			planner.secrets[cluster.Namespace+"/registry-tls"] = &corev1.Secret{Data: map[string][]byte{
+				corev1.TLSCertKey:       []byte("cert"),
+				corev1.TLSPrivateKeyKey: []byte("key"),
+			}}
+
+			files, err := planner.registriesFiles(cluster, RuntimeK3S)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]string{}
+			for _, file := range files {
+				content, err := base64.StdEncoding.DecodeString(file.Content)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[file.Path] = string(content)
+			}
+			if len(got) == 0 {
+				got = nil
+			}
+			if !equality.Semantic.DeepEqual(got, tt.want) {
+				t.Errorf("registriesFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistriesFilesMissingSecret(t *testing.T) {
+	planner := newTestPlanner(t)
+	cluster := testCluster()
+	cluster.Spec.Registries = &rkev1.Registry{
+		Configs: map[string]rkev1.RegistryConfig{
+			"registry.example.com": {AuthConfigSecretName: "missing"},
+		},
+	}
+
+	if _, err := planner.registriesFiles(cluster, RuntimeK3S); !apierror.IsNotFound(err) {
+		t.Errorf("registriesFiles() with a missing credential secret = %v, want not found", err)
+	}
+}
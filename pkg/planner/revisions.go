@@ -0,0 +1,212 @@
+package planner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+)
+
+// setPlanRevision starts a new plan revision when the spec of the cluster changed. Setting a rollback changes the spec
+// as well, so a rollback gets a revision of its own and the history of the revision rolled back to is kept.
+func setPlanRevision(cluster *rkev1.RKECluster) {
+	revisions := append([]rkev1.PlanRevision{}, cluster.Status.PlanRevisions...)
+	if len(revisions) > 0 && revisions[len(revisions)-1].Generation == cluster.Generation {
+		// the version of a revision changes once a rejected version change is allowed, such as after an upgrade
+		revisions[len(revisions)-1].KubernetesVersion = cluster.Spec.KubernetesVersion
+		cluster.Status.PlanRevisions = revisions
+		cluster.Status.PlanRevision = revisions[len(revisions)-1].Revision
+		return
+	}
+
+	var revision int64 = 1
+	if len(revisions) > 0 {
+		revision = revisions[len(revisions)-1].Revision + 1
+	}
+
+	entry := rkev1.PlanRevision{
+		Revision:          revision,
+		Generation:        cluster.Generation,
+		KubernetesVersion: cluster.Spec.KubernetesVersion,
+	}
+	if rollback := cluster.Spec.PlanRollback; rollback != nil {
+		entry.RollbackTo = rollback.Revision
+	}
+
+	revisions = append(revisions, entry)
+	if len(revisions) > PlanHistoryLimit {
+		revisions = revisions[len(revisions)-PlanHistoryLimit:]
+	}
+
+	cluster.Status.PlanRevisions = revisions
+	cluster.Status.PlanRevision = revision
+}
+
+// rollbackVersion sets the Kubernetes version of the cluster to the version of the revision rolled back to. A
+// rollback to a revision that is not in the history is rejected and dropped from the cluster.
+func rollbackVersion(cluster *rkev1.RKECluster) error {
+	rollback := cluster.Spec.PlanRollback
+	if rollback == nil {
+		return nil
+	}
+	if rollback.Revision == 0 {
+		cluster.Spec.PlanRollback = nil
+		return nil
+	}
+
+	for _, revision := range cluster.Status.PlanRevisions {
+		if revision.Revision == rollback.Revision && revision.KubernetesVersion != "" {
+			cluster.Spec.KubernetesVersion = revision.KubernetesVersion
+			return nil
+		}
+	}
+
+	cluster.Spec.PlanRollback = nil
+	return fmt.Errorf("rollback to plan revision %d is rejected, the revision is not in the plan history", rollback.Revision)
+}
+
+// rollbackConfigKeys are rendered from the current state of the cluster when rolling back: the join tokens, the S3
+// credentials and the servers to join or initialize
+var rollbackConfigKeys = []string{
+	"agent-token",
+	"cluster-init",
+	"etcd-s3-access-key",
+	"etcd-s3-secret-key",
+	"server",
+	"token",
+}
+
+// rollbackPlan returns the plan the machine applied for the revision being rolled back to: its files, config,
+// instructions and probes. Credentials always come from the desired plan so a rollback never rolls out rotated or
+// revoked ones, as do the instructions that only run once.
+func rollbackPlan(cluster *rkev1.RKECluster, entry planEntry, desired plan.NodePlan) (plan.NodePlan, bool, error) {
+	rollback := cluster.Spec.PlanRollback
+	if rollback == nil || rollback.Revision == 0 || entry.Plan == nil {
+		return desired, false, nil
+	}
+
+	for _, revision := range entry.Plan.History {
+		if revision.Revision != rollback.Revision {
+			continue
+		}
+		if _, ok := findInstallInstruction(revision.Plan); !ok {
+			return desired, false, nil
+		}
+
+		files, err := rollbackFiles(GetRuntime(cluster.Spec.KubernetesVersion), revision.Plan.Files, desired.Files)
+		if err != nil {
+			return desired, false, err
+		}
+		return plan.NodePlan{
+			Files:        files,
+			Instructions: rollbackInstructions(revision.Plan.Instructions, desired.Instructions),
+			Probes:       revision.Plan.Probes,
+		}, true, nil
+	}
+
+	return desired, false, nil
+}
+
+// rollbackFiles returns the files of the revision with the credential files of the desired plan and the config of the
+// revision with the rollbackConfigKeys of the desired config
+func rollbackFiles(runtime string, revision, desired []plan.File) (result []plan.File, _ error) {
+	configPath := fmt.Sprintf("/etc/rancher/%s/config.yaml", runtime)
+
+	for _, file := range revision {
+		if isCredentialFile(runtime, file.Path) {
+			continue
+		}
+		if file.Path == configPath {
+			config, err := rollbackConfig(file, desired, configPath)
+			if err != nil {
+				return nil, err
+			}
+			file = config
+		}
+		result = append(result, file)
+	}
+
+	for _, file := range desired {
+		if isCredentialFile(runtime, file.Path) {
+			result = append(result, file)
+		}
+	}
+
+	return result, nil
+}
+
+func rollbackConfig(revision plan.File, desired []plan.File, configPath string) (plan.File, error) {
+	config, err := decodeConfig(revision)
+	if err != nil {
+		return revision, err
+	}
+
+	current := map[string]interface{}{}
+	for _, file := range desired {
+		if file.Path == configPath {
+			if current, err = decodeConfig(file); err != nil {
+				return revision, err
+			}
+		}
+	}
+
+	for _, key := range rollbackConfigKeys {
+		if value, ok := current[key]; ok {
+			config[key] = value
+		} else {
+			delete(config, key)
+		}
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return revision, err
+	}
+	revision.Content = base64.StdEncoding.EncodeToString(data)
+	return revision, nil
+}
+
+func decodeConfig(file plan.File) (map[string]interface{}, error) {
+	data, err := base64.StdEncoding.DecodeString(file.Content)
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]interface{}{}
+	return config, json.Unmarshal(data, &config)
+}
+
+// isCredentialFile is true for the files of a plan holding credentials: the plan public keys, the cluster agent
+// manifest with its registration token and the registries config with its TLS files
+func isCredentialFile(runtime, path string) bool {
+	return path == PlanPublicKeysFile ||
+		path == fmt.Sprintf("/var/lib/rancher/%s/server/manifests/cluster-agent.yaml", runtime) ||
+		path == fmt.Sprintf("/etc/rancher/%s/registries.yaml", runtime) ||
+		strings.HasPrefix(path, fmt.Sprintf("/etc/rancher/%s/registries/", runtime))
+}
+
+// rollbackInstructions returns the instructions of the revision in place of the instructions of the desired plan
+// that run with every new plan, the one time instructions of the desired plan stay where they are
+func rollbackInstructions(revision, desired []plan.Instruction) (result []plan.Instruction) {
+	replaced := false
+	for _, instruction := range desired {
+		if isOneTimeInstruction(instruction) {
+			result = append(result, instruction)
+		} else if !replaced {
+			result = append(result, withoutOneTimeInstructions(revision)...)
+			replaced = true
+		}
+	}
+	return result
+}
+
+func findInstallInstruction(nodePlan plan.NodePlan) (plan.Instruction, bool) {
+	for _, instruction := range nodePlan.Instructions {
+		if isInstallInstruction(instruction) {
+			return instruction, true
+		}
+	}
+	return plan.Instruction{}, false
+}
@@ -0,0 +1,199 @@
+package planner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRollbackPlan(t *testing.T) {
+	configPath := "/etc/rancher/k3s/config.yaml"
+	oldInstall := plan.Instruction{Image: "installer:v1.19.8", Command: "sh", Args: installArgs}
+	install := plan.Instruction{Image: "installer:v1.20.4", Command: "sh", Args: installArgs}
+	snapshot := plan.Instruction{Name: "etcd-snapshot-2", Command: "k3s"}
+	oldProbes := map[string]plan.Probe{"kubelet": {InitialDelaySeconds: 1}}
+
+	desired := plan.NodePlan{
+		Files: []plan.File{
+			configFile(t, configPath, map[string]interface{}{"token": "new", "kubelet-arg": "max-pods=200"}),
+			{Path: PlanPublicKeysFile, Content: "new keys"},
+		},
+		Instructions: []plan.Instruction{install, snapshot},
+	}
+	node := &plan.Node{
+		History: []plan.Revision{
+			{
+				Revision: 1,
+				Plan: plan.NodePlan{
+					Files: []plan.File{
+						configFile(t, configPath, map[string]interface{}{"token": "old", "kubelet-arg": "max-pods=110", "server": "https://old:9345"}),
+						{Path: "/etc/file", Content: "old file"},
+						{Path: PlanPublicKeysFile, Content: "old keys"},
+					},
+					Instructions: []plan.Instruction{{Name: "etcd-snapshot-1", Command: "k3s"}, oldInstall},
+					Probes:       oldProbes,
+				},
+			},
+			{
+				Revision: 2,
+				Plan:     plan.NodePlan{Files: []plan.File{{Path: "/etc/file"}}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		rollback *rkev1.PlanRollback
+		node     *plan.Node
+		want     plan.NodePlan
+		ok       bool
+	}{
+		{
+			name: "no rollback",
+			node: node,
+			want: desired,
+		},
+		{
+			name:     "unknown revision",
+			rollback: &rkev1.PlanRollback{Revision: 5},
+			node:     node,
+			want:     desired,
+		},
+		{
+			name:     "no plan",
+			rollback: &rkev1.PlanRollback{Revision: 1},
+			want:     desired,
+		},
+		{
+			name:     "revision without installer",
+			rollback: &rkev1.PlanRollback{Revision: 2},
+			node:     node,
+			want:     desired,
+		},
+		{
+			// files, config, installer and probes of the revision with the current credentials and snapshot
+			name:     "plan rolled back",
+			rollback: &rkev1.PlanRollback{Revision: 1},
+			node:     node,
+			want: plan.NodePlan{
+				Files: []plan.File{
+					configFile(t, configPath, map[string]interface{}{"token": "new", "kubelet-arg": "max-pods=110"}),
+					{Path: "/etc/file", Content: "old file"},
+					{Path: PlanPublicKeysFile, Content: "new keys"},
+				},
+				Instructions: []plan.Instruction{oldInstall, snapshot},
+				Probes:       oldProbes,
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &rkev1.RKECluster{}
+			cluster.Spec.KubernetesVersion = "v1.19.8+k3s1"
+			cluster.Spec.PlanRollback = tt.rollback
+
+			got, ok, err := rollbackPlan(cluster, planEntry{Machine: testMachine("machine-1", nil), Plan: tt.node}, desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok {
+				t.Errorf("rollbackPlan() ok = %v, want %v", ok, tt.ok)
+			}
+			if !equality.Semantic.DeepEqual(got, tt.want) {
+				t.Errorf("rollbackPlan() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func configFile(t *testing.T, path string, config map[string]interface{}) plan.File {
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan.File{Path: path, Content: base64.StdEncoding.EncodeToString(data)}
+}
+
+func TestSetPlanRevision(t *testing.T) {
+	cluster := &rkev1.RKECluster{}
+	cluster.Generation = 1
+	cluster.Spec.KubernetesVersion = "v1.20.4+k3s1"
+	setPlanRevision(cluster)
+
+	// a rollback changes the spec and is recorded as a new revision, revision 1 stays as it was
+	cluster.Generation = 2
+	cluster.Spec.PlanRollback = &rkev1.PlanRollback{Revision: 1}
+	setPlanRevision(cluster)
+	setPlanRevision(cluster)
+
+	want := []rkev1.PlanRevision{
+		{Revision: 1, Generation: 1, KubernetesVersion: "v1.20.4+k3s1"},
+		{Revision: 2, Generation: 2, KubernetesVersion: "v1.20.4+k3s1", RollbackTo: 1},
+	}
+	if !equality.Semantic.DeepEqual(cluster.Status.PlanRevisions, want) {
+		t.Errorf("plan revisions = %+v, want %+v", cluster.Status.PlanRevisions, want)
+	}
+	if cluster.Status.PlanRevision != 2 {
+		t.Errorf("plan revision = %d, want 2", cluster.Status.PlanRevision)
+	}
+}
+
+func TestProcessRollback(t *testing.T) {
+	planner := newTestPlanner(t)
+	cluster := testCluster()
+	cluster.Generation = 1
+	planner.addMachine(cluster, "machine-1", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+	planner.process(t, cluster)
+	revision := planner.plan(t, "machine-1")
+
+	// the upgrade changes the config and rotates the join tokens along the way
+	cluster.Generation = 2
+	cluster.Spec.KubernetesVersion = "v1.20.5+k3s1"
+	cluster.Spec.Config = []rkev1.RKESystemConfig{{
+		MachineLabelSelector: &metav1.LabelSelector{},
+		Config:               rkev1.GenericMap{Data: map[string]interface{}{"kubelet-arg": "max-pods=200"}},
+	}}
+	cluster.Spec.RotateJoinTokens = &rkev1.RotateJoinTokens{Generation: 1}
+	planner.process(t, cluster)
+	if cluster.Status.KubernetesVersion != "v1.20.5+k3s1" {
+		t.Fatalf("upgrade did not finish, version is %q", cluster.Status.KubernetesVersion)
+	}
+
+	cluster.Generation = 3
+	cluster.Spec.PlanRollback = &rkev1.PlanRollback{Revision: 1}
+	planner.process(t, cluster)
+	if !KubernetesVersionValid.IsTrue(&cluster.Status) || cluster.Status.KubernetesVersion != "v1.20.4+k3s1" {
+		t.Fatalf("rollback to the version of revision 1 did not finish: %+v", cluster.Status)
+	}
+
+	got := planner.plan(t, "machine-1")
+	install, _ := findInstallInstruction(got)
+	previous, _ := findInstallInstruction(revision)
+	if !equality.Semantic.DeepEqual(install, previous) {
+		t.Errorf("rollback installs %+v, want the installer of revision 1 %+v", install, previous)
+	}
+
+	config := map[string]interface{}{}
+	for _, file := range got.Files {
+		if file.Path == "/etc/rancher/k3s/config.yaml" {
+			var err error
+			if config, err = decodeConfig(file); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	state := planner.secrets[cluster.Namespace+"/"+cluster.Status.ClusterStateSecretName]
+	if _, ok := config["kubelet-arg"]; ok {
+		t.Errorf("rollback keeps the config of revision 2: %v", config)
+	}
+	if config["token"] != string(state.Data["serverToken"]) {
+		t.Errorf("rollback rolls out the join token of revision 1")
+	}
+}
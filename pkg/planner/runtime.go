@@ -0,0 +1,50 @@
+package planner
+
+import (
+	"strings"
+)
+
+const (
+	RuntimeK3S  = "k3s"
+	RuntimeRKE2 = "rke2"
+)
+
+// GetRuntime returns the distribution used to install the given Kubernetes version. Versions are
+// expected to carry the distribution in the build metadata, such as v1.20.4+k3s1 or v1.20.4+rke2r1.
+func GetRuntime(kubernetesVersion string) string {
+	if strings.Contains(kubernetesVersion, RuntimeRKE2) {
+		return RuntimeRKE2
+	}
+	return RuntimeK3S
+}
+
+// GetRuntimeSupervisorPort returns the port servers and agents use to join an existing server.
+func GetRuntimeSupervisorPort(kubernetesVersion string) int {
+	if GetRuntime(kubernetesVersion) == RuntimeRKE2 {
+		return 9345
+	}
+	return 6443
+}
+
+// GetRuntimeAPIServerPort returns the port of the Kubernetes API on the servers.
+func GetRuntimeAPIServerPort(kubernetesVersion string) int {
+	return 6443
+}
+
+// GetRuntimeEnv returns the prefix used by the runtime install script for its environment variables.
+func GetRuntimeEnv(kubernetesVersion string) string {
+	return strings.ToUpper(GetRuntime(kubernetesVersion))
+}
+
+// GetRuntimeServerUnit returns the name of the systemd unit running the server.
+func GetRuntimeServerUnit(kubernetesVersion string) string {
+	if GetRuntime(kubernetesVersion) == RuntimeRKE2 {
+		return "rke2-server"
+	}
+	return "k3s"
+}
+
+// GetRuntimeAgentUnit returns the name of the systemd unit running the agent.
+func GetRuntimeAgentUnit(kubernetesVersion string) string {
+	return GetRuntime(kubernetesVersion) + "-agent"
+}
@@ -0,0 +1,56 @@
+package planner
+
+import (
+	"testing"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/versions"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+func TestGetRuntime(t *testing.T) {
+	for version, want := range map[string]string{
+		"":               RuntimeK3S,
+		"v1.20.4+k3s1":   RuntimeK3S,
+		"v1.20.4+rke2r1": RuntimeRKE2,
+	} {
+		if got := GetRuntime(version); got != want {
+			t.Errorf("GetRuntime(%q) = %s, want %s", version, got, want)
+		}
+	}
+
+	if port := GetRuntimeSupervisorPort("v1.20.4+k3s1"); port != 6443 {
+		t.Errorf("k3s servers are joined on port %d, want 6443", port)
+	}
+	if port := GetRuntimeSupervisorPort("v1.20.4+rke2r1"); port != 9345 {
+		t.Errorf("rke2 servers are joined on port %d, want 9345", port)
+	}
+}
+
+func TestInstallInstruction(t *testing.T) {
+	version := &versions.Version{InstallerImage: "installer"}
+
+	tests := []struct {
+		kubernetesVersion string
+		agent             bool
+		env               []string
+	}{
+		{"v1.20.4+k3s1", false, []string{"INSTALL_K3S_VERSION=v1.20.4+k3s1"}},
+		{"v1.20.4+k3s1", true, []string{"INSTALL_K3S_VERSION=v1.20.4+k3s1", "INSTALL_K3S_EXEC=agent"}},
+		{"v1.20.4+rke2r1", false, []string{"INSTALL_RKE2_VERSION=v1.20.4+rke2r1"}},
+		{"v1.20.4+rke2r1", true, []string{"INSTALL_RKE2_VERSION=v1.20.4+rke2r1", "INSTALL_RKE2_TYPE=agent"}},
+	}
+
+	for _, tt := range tests {
+		cluster := &rkev1.RKECluster{}
+		cluster.Spec.KubernetesVersion = tt.kubernetesVersion
+
+		instruction := installInstruction(cluster, version, tt.agent)
+		if !isInstallInstruction(instruction) || instruction.Image != "installer" {
+			t.Errorf("%s: %+v does not run the installer", tt.kubernetesVersion, instruction)
+		}
+		if !equality.Semantic.DeepEqual(instruction.Env, tt.env) {
+			t.Errorf("%s agent=%v: env = %v, want %v", tt.kubernetesVersion, tt.agent, instruction.Env, tt.env)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package planner
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// PlanPublicKeysFile holds the public keys of the plan signing keys on every machine, agents accept a new plan
+	// when it is signed by one of the keys of the plan they applied last
+	PlanPublicKeysFile = "/etc/rancher/agent/plan-public-keys.pem"
+
+	planSigningKey    = "planSigningKey"
+	newPlanSigningKey = "newPlanSigningKey"
+)
+
+func rotatingPlanSigningKey(cluster *rkev1.RKECluster) bool {
+	return cluster.Spec.RotatePlanSigningKey != nil &&
+		cluster.Spec.RotatePlanSigningKey.Generation != cluster.Status.PlanSigningKeyRotationGeneration
+}
+
+// ensurePlanSigningKeys makes sure the state secret holds a new key while the key is rotated, the current key is
+// generated with the state secret. The public keys of both are rolled out to the machines.
+func (p *Planner) ensurePlanSigningKeys(cluster *rkev1.RKECluster, secret *corev1.Secret) (*corev1.Secret, error) {
+	if !rotatingPlanSigningKey(cluster) || len(secret.Data[newPlanSigningKey]) > 0 {
+		return secret, nil
+	}
+
+	data, err := generatePlanSigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data[newPlanSigningKey] = data
+	return p.secretClient.Update(secret)
+}
+
+// PlanPublicKeys returns the PEM encoded public keys of the plan signing keys in the data of a state secret
+func PlanPublicKeys(data map[string][]byte) (string, error) {
+	buf := &strings.Builder{}
+	for _, key := range []string{planSigningKey, newPlanSigningKey} {
+		if len(data[key]) == 0 {
+			continue
+		}
+
+		privateKey, err := parsePlanSigningKey(data[key])
+		if err != nil {
+			return "", err
+		}
+
+		der, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+		if err != nil {
+			return "", err
+		}
+		buf.Write(pem.EncodeToMemory(&pem.Block{
+			Type:  "PUBLIC KEY",
+			Bytes: der,
+		}))
+	}
+	return buf.String(), nil
+}
+
+func planPublicKeysFiles(secret plan.Secret) []plan.File {
+	if secret.PlanPublicKeys == "" {
+		return nil
+	}
+	return []plan.File{
+		{
+			Content: base64.StdEncoding.EncodeToString([]byte(secret.PlanPublicKeys)),
+			Path:    PlanPublicKeysFile,
+		},
+	}
+}
+
+// planPublicKeysPlan returns the plan that writes the plan public keys of the desired plan without running anything, if
+// they are all that changed since the last plan in the history of the node. Like a snapshot it runs on top of that
+// plan, so a key rotation neither reinstalls nor drains the machines.
+func planPublicKeysPlan(node *plan.Node, desired plan.NodePlan) (plan.NodePlan, bool) {
+	if node == nil || len(node.History) == 0 {
+		return desired, false
+	}
+
+	last := node.History[len(node.History)-1].Plan
+	if len(desired.Instructions) == 0 ||
+		!equality.Semantic.DeepEqual(withoutOneTimeInstructions(last.Instructions), desired.Instructions) ||
+		!equality.Semantic.DeepEqual(last.Probes, desired.Probes) ||
+		!equality.Semantic.DeepEqual(withoutFile(last.Files, PlanPublicKeysFile), withoutFile(desired.Files, PlanPublicKeysFile)) {
+		return desired, false
+	}
+
+	return plan.NodePlan{
+		Files:  desired.Files,
+		Probes: desired.Probes,
+	}, true
+}
+
+func withoutFile(files []plan.File, path string) (result []plan.File) {
+	for _, file := range files {
+		if file.Path != path {
+			result = append(result, file)
+		}
+	}
+	return result
+}
+
+func generatePlanSigningKey() ([]byte, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	}), nil
+}
+
+func parsePlanSigningKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("plan signing key is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("plan signing key is a %T, not an ed25519 key", key)
+	}
+	return privateKey, nil
+}
+
+// signPlan returns the base64 encoded ed25519 signature of the plan data
+func signPlan(key, data []byte) (string, error) {
+	privateKey, err := parsePlanSigningKey(key)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, data)), nil
+}
+
+// setPlanSigningKeyRotationProgress records which machines are receiving the new public key while a rotation is
+// pending
+func setPlanSigningKeyRotationProgress(cluster *rkev1.RKECluster, stage string) {
+	if !rotatingPlanSigningKey(cluster) {
+		return
+	}
+	PlanSigningKeyRotated.Unknown(&cluster.Status)
+	PlanSigningKeyRotated.Reason(&cluster.Status, "Rotating")
+	PlanSigningKeyRotated.Message(&cluster.Status, fmt.Sprintf("rolling out plan signing key to %s machines", stage))
+}
+
+// finishPlanSigningKeyRotation signs plans with the new key once every machine trusts it, the previous key is
+// removed from the machines with the next rollout
+func (p *Planner) finishPlanSigningKeyRotation(cluster *rkev1.RKECluster) error {
+	if !rotatingPlanSigningKey(cluster) {
+		return nil
+	}
+
+	secret, err := p.secretClient.Get(cluster.Namespace, cluster.Status.ClusterStateSecretName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if len(secret.Data[newPlanSigningKey]) > 0 {
+		secret = secret.DeepCopy()
+		secret.Data[planSigningKey] = secret.Data[newPlanSigningKey]
+		delete(secret.Data, newPlanSigningKey)
+		if _, err := p.secretClient.Update(secret); err != nil {
+			return err
+		}
+	}
+
+	cluster.Status.PlanSigningKeyRotationGeneration = cluster.Spec.RotatePlanSigningKey.Generation
+	PlanSigningKeyRotated.SetError(&cluster.Status, "", nil)
+	return nil
+}
@@ -0,0 +1,109 @@
+package planner
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+)
+
+func TestSignPlan(t *testing.T) {
+	key, err := generatePlanSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKeys, err := PlanPublicKeys(map[string][]byte{planSigningKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode([]byte(publicKeys))
+	if block == nil {
+		t.Fatalf("public keys are not PEM encoded: %q", publicKeys)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(`{"files":[]}`)
+	signature, err := signPlan(key, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ed25519.Verify(publicKey.(ed25519.PublicKey), data, decoded) {
+		t.Error("signature does not verify with the public key")
+	}
+	if ed25519.Verify(publicKey.(ed25519.PublicKey), []byte(`{"files":null}`), decoded) {
+		t.Error("signature verifies other data")
+	}
+}
+
+func TestPlanPublicKeys(t *testing.T) {
+	key, err := generatePlanSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := generatePlanSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// machines trust the current and the new key while the key is rotated
+	publicKeys, err := PlanPublicKeys(map[string][]byte{planSigningKey: key, newPlanSigningKey: newKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.Count(publicKeys, "BEGIN PUBLIC KEY"); count != 2 {
+		t.Errorf("PlanPublicKeys() returned %d keys while rotating, want 2", count)
+	}
+
+	if _, err := PlanPublicKeys(map[string][]byte{planSigningKey: []byte("invalid")}); err == nil {
+		t.Error("PlanPublicKeys() of an invalid key succeeded")
+	}
+}
+
+func TestProcessPlanSigningKeyRotation(t *testing.T) {
+	planner := newTestPlanner(t)
+	cluster := testCluster()
+	planner.addMachine(cluster, "machine-1", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+	planner.addMachine(cluster, "machine-2", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+	planner.process(t, cluster)
+	before := publicKeysFile(planner.plan(t, "machine-2"))
+
+	cluster.Spec.RotatePlanSigningKey = &rkev1.RotatePlanSigningKey{Generation: 1}
+	planner.process(t, cluster)
+	if cluster.Status.PlanSigningKeyRotationGeneration != 1 || !PlanSigningKeyRotated.IsTrue(&cluster.Status) {
+		t.Fatalf("plan signing key rotation of a cluster without worker-only machines did not finish: %+v", cluster.Status)
+	}
+
+	for _, name := range []string{"machine-1", "machine-2"} {
+		nodePlan := planner.plan(t, name)
+		if after := publicKeysFile(nodePlan); after == before || strings.Count(after, "BEGIN PUBLIC KEY") != 1 {
+			t.Errorf("%s trusts %s after the rotation, want only the new key", name, after)
+		}
+		if len(nodePlan.Instructions) > 0 || planner.installs[name] != 1 {
+			t.Errorf("%s was installed %d times, the key rotation ran %v", name, planner.installs[name], nodePlan.Instructions)
+		}
+	}
+}
+
+func publicKeysFile(nodePlan plan.NodePlan) string {
+	for _, file := range nodePlan.Files {
+		if file.Path == PlanPublicKeysFile {
+			data, _ := base64.StdEncoding.DecodeString(file.Content)
+			return string(data)
+		}
+	}
+	return ""
+}
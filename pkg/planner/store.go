@@ -2,12 +2,19 @@ package planner
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
 
 	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
 	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
 	capicontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/cluster.x-k8s.io/v1alpha4"
 	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/name"
 	corev1 "k8s.io/api/core/v1"
 	apierror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -58,28 +65,93 @@ func (p *planStore) Load(cluster *rkev1.RKECluster) (*plan.Plan, error) {
 	return result, nil
 }
 
+const (
+	// PlanHistoryLimit is the number of applied plans kept in the plan secret of a machine
+	PlanHistoryLimit = 5
+	// maxPlanSecretSize leaves room for the metadata of the plan secret below the 1MiB limit of a secret
+	maxPlanSecretSize = 1000 * 1024
+)
+
+// ErrPlanTooLarge is returned when a plan does not fit into the plan secret of its machine
+var ErrPlanTooLarge = errors.New("plan too large")
+
+// secretToNode reads the plan secret of a machine. The planner writes the keys plan, plan-signature, revision and
+// attempt. Once a plan is applied it is copied to appliedPlan and added to plan-history. The agent reports back on
+// every attempt to apply the plan:
+//
+//	applied-checksum  sha256 of the last plan applied successfully
+//	failed-checksum   sha256 of the last plan that failed to apply
+//	failure-count     number of consecutive failed attempts to apply failed-checksum
+//	failure-output    output of the last failed attempt
+//	failed-at         RFC3339 time of the last failed attempt
+//	applied-attempt   value of attempt when the plan was last applied
+//	probe-statuses    JSON of the status of each probe of the applied plan, agents without probe support do not
+//	                  report it and are healthy once they applied their plan
+//
+// The agent applies a plan when its checksum differs from applied-checksum and either differs from
+// failed-checksum or attempt differs from applied-attempt, so a failed plan is only retried when asked to.
+//
+// plan-signature is the base64 encoded ed25519 signature of plan by the plan signing key of the cluster. Agents
+// verify it with the public keys of their bootstrap script or of PlanPublicKeysFile of the last applied plan.
+//
+// Plans carry the version of their format, see plan.Version. The content of large files is gzip compressed, plans
+// are decoded when they are read so they can be compared to the desired plan.
 func (p *planStore) secretToNode(secret *corev1.Secret) (*plan.Node, error) {
 	result := &plan.Node{}
 	planData := secret.Data["plan"]
 	appliedPlanData := secret.Data["appliedPlan"]
 
 	if len(planData) > 0 {
-		if err := json.Unmarshal(planData, &result.Plan); err != nil {
+		nodePlan, err := unmarshalPlan(planData)
+		if err != nil {
 			return nil, err
 		}
+		result.Plan = nodePlan
 	} else {
 		return nil, nil
 	}
 
 	if len(appliedPlanData) > 0 {
-		newPlan := &plan.NodePlan{}
-		if err := json.Unmarshal(appliedPlanData, newPlan); err != nil {
+		newPlan, err := unmarshalPlan(appliedPlanData)
+		if err != nil {
+			return nil, err
+		}
+		result.AppliedPlan = &newPlan
+	}
+
+	if historyData := secret.Data["plan-history"]; len(historyData) > 0 {
+		if err := json.Unmarshal(historyData, &result.History); err != nil {
+			return nil, err
+		}
+		for i, revision := range result.History {
+			nodePlan, err := decodePlan(revision.Plan)
+			if err != nil {
+				return nil, err
+			}
+			result.History[i].Plan = nodePlan
+		}
+	}
+
+	if probeData := secret.Data["probe-statuses"]; len(probeData) > 0 {
+		if err := json.Unmarshal(probeData, &result.ProbeStatus); err != nil {
 			return nil, err
 		}
-		result.AppliedPlan = newPlan
 	}
 
 	result.InSync = bytes.Equal(planData, appliedPlanData)
+	result.Healthy = result.AppliedPlan != nil && len(failingProbes(result.AppliedPlan, result.ProbeStatus)) == 0
+	result.Attempt, _ = strconv.Atoi(string(secret.Data["attempt"]))
+	result.Revision, _ = strconv.ParseInt(string(secret.Data["revision"]), 10, 64)
+
+	// failures of previous plans are not relevant anymore
+	if !result.InSync && string(secret.Data["failed-checksum"]) == checksum(planData) {
+		result.Failures, _ = strconv.Atoi(string(secret.Data["failure-count"]))
+		result.FailureOutput = string(secret.Data["failure-output"])
+		if failedAt, err := time.Parse(time.RFC3339, string(secret.Data["failed-at"])); err == nil {
+			result.FailedAt = &metav1.Time{Time: failedAt}
+		}
+	}
+
 	return result, nil
 }
 
@@ -99,12 +171,70 @@ func (p *planStore) getSecrets(machines []*capi.Machine) (map[string]*corev1.Sec
 	return result, nil
 }
 
-func (p *planStore) UpdatePlan(machine *capi.Machine, plan plan.NodePlan) error {
-	data, err := json.Marshal(plan)
+// UpdatePlan writes the plan of the machine, revision is the cluster plan revision the plan belongs to or 0 for
+// plans that are not part of the history, such as the plans of an etcd restore. ErrPlanTooLarge is returned if the
+// plan would not fit into the secret once applied.
+func (p *planStore) UpdatePlan(machine *capi.Machine, nodePlan plan.NodePlan, revision int64) error {
+	data, secret, err := p.preparePlan(machine, nodePlan)
 	if err != nil {
 		return err
 	}
 
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+
+	signature, err := p.signPlan(machine, data)
+	if err != nil {
+		return err
+	}
+
+	secret.Data["plan"] = data
+	if signature == "" {
+		delete(secret.Data, "plan-signature")
+	} else {
+		secret.Data["plan-signature"] = []byte(signature)
+	}
+	secret.Data["revision"] = []byte(strconv.FormatInt(revision, 10))
+	delete(secret.Data, "attempt")
+	_, err = p.secrets.Update(secret)
+	return err
+}
+
+// CheckPlanSize returns ErrPlanTooLarge if the plan would not fit into the plan secret of the machine once applied
+func (p *planStore) CheckPlanSize(machine *capi.Machine, nodePlan plan.NodePlan) error {
+	_, _, err := p.preparePlan(machine, nodePlan)
+	return err
+}
+
+// preparePlan encodes the plan of the machine and returns it with the plan secret it is written to
+func (p *planStore) preparePlan(machine *capi.Machine, nodePlan plan.NodePlan) ([]byte, *corev1.Secret, error) {
+	encoded, err := encodePlan(nodePlan)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secret, err := p.secrets.Get(machine.Namespace, PlanSecretFromMachine(machine), metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the plan is stored twice once applied, as plan and as appliedPlan, the history is trimmed to fit
+	if size := 2*len(data) + secretDataSize(secret.Data, "plan", "appliedPlan", "plan-history"); size > maxPlanSecretSize {
+		return nil, nil, fmt.Errorf("%w: plan of machine %s needs %d bytes of its secret, at most %d bytes are available",
+			ErrPlanTooLarge, machine.Name, size, maxPlanSecretSize)
+	}
+
+	return data, secret, nil
+}
+
+// RetryPlan asks the agent to apply the failed plan of the machine again
+func (p *planStore) RetryPlan(machine *capi.Machine, attempt int) error {
 	secret, err := p.secrets.Get(machine.Namespace, PlanSecretFromMachine(machine), metav1.GetOptions{})
 	if err != nil {
 		return err
@@ -114,7 +244,98 @@ func (p *planStore) UpdatePlan(machine *capi.Machine, plan plan.NodePlan) error
 		secret.Data = map[string][]byte{}
 	}
 
-	secret.Data["plan"] = data
+	secret.Data["attempt"] = []byte(strconv.Itoa(attempt))
 	_, err = p.secrets.Update(secret)
 	return err
 }
+
+// RecordAppliedPlan marks the plan of the secret as applied and adds it to the history of the machine. The secret
+// is modified in place.
+func RecordAppliedPlan(secret *corev1.Secret) error {
+	planData := secret.Data["plan"]
+	secret.Data["appliedPlan"] = planData
+
+	revision, _ := strconv.ParseInt(string(secret.Data["revision"]), 10, 64)
+	if revision == 0 {
+		return nil
+	}
+
+	var history []plan.Revision
+	if historyData := secret.Data["plan-history"]; len(historyData) > 0 {
+		if err := json.Unmarshal(historyData, &history); err != nil {
+			return err
+		}
+	}
+
+	entry := plan.Revision{
+		Revision: revision,
+	}
+	if err := json.Unmarshal(planData, &entry.Plan); err != nil {
+		return err
+	}
+
+	// a plan can change without a new revision, for example when machine labels change, only the last is kept
+	if len(history) > 0 && history[len(history)-1].Revision == revision {
+		history = history[:len(history)-1]
+	}
+	history = append(history, entry)
+	if len(history) > PlanHistoryLimit {
+		history = history[len(history)-PlanHistoryLimit:]
+	}
+
+	// the oldest plans are dropped when the history does not fit into the secret
+	for len(history) > 0 {
+		historyData, err := json.Marshal(history)
+		if err != nil {
+			return err
+		}
+		if len(historyData)+secretDataSize(secret.Data, "plan-history") <= maxPlanSecretSize {
+			secret.Data["plan-history"] = historyData
+			return nil
+		}
+		history = history[1:]
+	}
+
+	delete(secret.Data, "plan-history")
+	return nil
+}
+
+// signPlan signs the plan data with the plan signing key of the cluster of the machine, clusters without a key
+// yet get unsigned plans
+func (p *planStore) signPlan(machine *capi.Machine, data []byte) (string, error) {
+	state, err := p.secrets.Get(machine.Namespace, name.SafeConcatName(machine.Spec.ClusterName, "rke", "state"), metav1.GetOptions{})
+	if apierror.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if len(state.Data[planSigningKey]) == 0 {
+		return "", nil
+	}
+	return signPlan(state.Data[planSigningKey], data)
+}
+
+func unmarshalPlan(data []byte) (plan.NodePlan, error) {
+	var nodePlan plan.NodePlan
+	if err := json.Unmarshal(data, &nodePlan); err != nil {
+		return nodePlan, err
+	}
+	return decodePlan(nodePlan)
+}
+
+// secretDataSize returns the size of the data of a secret without the skipped keys
+func secretDataSize(data map[string][]byte, skip ...string) (size int) {
+	for _, v := range data {
+		size += len(v)
+	}
+	for _, k := range skip {
+		size -= len(data[k])
+	}
+	return size
+}
+
+func checksum(data []byte) string {
+	result := sha256.Sum256(data)
+	return hex.EncodeToString(result[:])
+}
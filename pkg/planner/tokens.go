@@ -0,0 +1,101 @@
+package planner
+
+import (
+	"fmt"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/wrangler/pkg/randomtoken"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func rotatingJoinTokens(cluster *rkev1.RKECluster) bool {
+	return cluster.Spec.RotateJoinTokens != nil &&
+		cluster.Spec.RotateJoinTokens.Generation != cluster.Status.JoinTokenRotationGeneration
+}
+
+// ensureJoinTokens generates the new tokens once when a rotation is requested. They are stored in the state secret
+// next to the current tokens, which are only replaced once every machine is in sync.
+func (p *Planner) ensureJoinTokens(cluster *rkev1.RKECluster, secret *corev1.Secret) (*corev1.Secret, error) {
+	if !rotatingJoinTokens(cluster) || (len(secret.Data["newServerToken"]) > 0 && len(secret.Data["newAgentToken"]) > 0) {
+		return secret, nil
+	}
+
+	serverToken, err := randomtoken.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	agentToken, err := randomtoken.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data["newServerToken"] = []byte(serverToken)
+	secret.Data["newAgentToken"] = []byte(agentToken)
+	return p.secretClient.Update(secret)
+}
+
+// rotateServerTokenInstruction re-encrypts the bootstrap data of the cluster with the new server token. It runs on
+// every server before it is restarted with the new token, the init node rotates first and the other servers find the
+// new token already in place. Servers that never started have nothing to rotate. If the previous token of the state
+// secret is not accepted, the token the server currently runs with, as written to its token file, is tried instead.
+func rotateServerTokenInstruction(cluster *rkev1.RKECluster, runtime string, secret plan.Secret) *plan.Instruction {
+	if secret.PreviousServerToken == "" || cluster.Spec.RotateJoinTokens == nil {
+		return nil
+	}
+	return &plan.Instruction{
+		Name:    fmt.Sprintf("rotate-server-token-%d", cluster.Spec.RotateJoinTokens.Generation),
+		Command: "sh",
+		Args: []string{
+			"-c",
+			fmt.Sprintf(`[ ! -f /var/lib/rancher/%[1]s/server/token ] || `+
+				`%[1]s token rotate --token="$TOKEN" --new-token="$NEW_TOKEN" || `+
+				`%[1]s token rotate --token="$(cat /var/lib/rancher/%[1]s/server/token)" --new-token="$NEW_TOKEN"`, runtime),
+		},
+		Env: []string{
+			"TOKEN=" + secret.PreviousServerToken,
+			"NEW_TOKEN=" + secret.ServerToken,
+		},
+	}
+}
+
+// setJoinTokenRotationProgress records which machines are receiving the new join tokens while a rotation is pending
+func setJoinTokenRotationProgress(cluster *rkev1.RKECluster, stage string) {
+	if !rotatingJoinTokens(cluster) {
+		return
+	}
+	JoinTokensRotated.Unknown(&cluster.Status)
+	JoinTokensRotated.Reason(&cluster.Status, "Rotating")
+	JoinTokensRotated.Message(&cluster.Status, fmt.Sprintf("rolling out join tokens to %s machines", stage))
+}
+
+// finishJoinTokenRotation replaces the previous tokens in the state secret once every machine uses the new ones. The
+// rotate instruction is dropped from the desired plans then, which does not roll them out again.
+func (p *Planner) finishJoinTokenRotation(cluster *rkev1.RKECluster) error {
+	if !rotatingJoinTokens(cluster) {
+		return nil
+	}
+
+	secret, err := p.secretClient.Get(cluster.Namespace, cluster.Status.ClusterStateSecretName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if len(secret.Data["newServerToken"]) > 0 && len(secret.Data["newAgentToken"]) > 0 {
+		secret = secret.DeepCopy()
+		secret.Data["serverToken"] = secret.Data["newServerToken"]
+		secret.Data["agentToken"] = secret.Data["newAgentToken"]
+		delete(secret.Data, "newServerToken")
+		delete(secret.Data, "newAgentToken")
+		if _, err := p.secretClient.Update(secret); err != nil {
+			return err
+		}
+	}
+
+	cluster.Status.JoinTokenRotationGeneration = cluster.Spec.RotateJoinTokens.Generation
+	JoinTokensRotated.SetError(&cluster.Status, "", nil)
+	return nil
+}
@@ -0,0 +1,75 @@
+package planner
+
+import (
+	"strings"
+	"testing"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+)
+
+func TestPlanSecret(t *testing.T) {
+	data := map[string][]byte{
+		"serverToken":    []byte("server"),
+		"agentToken":     []byte("agent"),
+		"newServerToken": []byte("new-server"),
+		"newAgentToken":  []byte("new-agent"),
+	}
+
+	cluster := &rkev1.RKECluster{}
+	got, err := planSecret(cluster, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != (plan.Secret{ServerToken: "server", AgentToken: "agent"}) {
+		t.Errorf("planSecret() = %+v, want the current tokens", got)
+	}
+
+	cluster.Spec.RotateJoinTokens = &rkev1.RotateJoinTokens{Generation: 1}
+	got, err = planSecret(cluster, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != (plan.Secret{ServerToken: "new-server", AgentToken: "new-agent", PreviousServerToken: "server"}) {
+		t.Errorf("planSecret() = %+v, want the new tokens while rotating", got)
+	}
+}
+
+func TestRotateServerTokenInstruction(t *testing.T) {
+	cluster := &rkev1.RKECluster{}
+	cluster.Spec.RotateJoinTokens = &rkev1.RotateJoinTokens{Generation: 2}
+
+	if rotate := rotateServerTokenInstruction(cluster, RuntimeK3S, plan.Secret{ServerToken: "server"}); rotate != nil {
+		t.Errorf("servers are rotated without a previous token: %+v", rotate)
+	}
+
+	rotate := rotateServerTokenInstruction(cluster, RuntimeK3S, plan.Secret{ServerToken: "new-server", PreviousServerToken: "server"})
+	if rotate == nil || rotate.Name != "rotate-server-token-2" || !isOneTimeInstruction(*rotate) {
+		t.Fatalf("rotateServerTokenInstruction() = %+v, want a one time instruction of generation 2", rotate)
+	}
+	if script := rotate.Args[1]; strings.Contains(script, `--token="$NEW_TOKEN"`) {
+		t.Errorf("the new token is passed as the current token: %s", script)
+	}
+}
+
+func TestProcessJoinTokenRotation(t *testing.T) {
+	planner := newTestPlanner(t)
+	cluster := testCluster()
+	planner.addMachine(cluster, "machine-1", EtcdRoleLabel, ControlPlaneRoleLabel, WorkerRoleLabel)
+	planner.process(t, cluster)
+	previous := string(planner.secrets[cluster.Namespace+"/"+cluster.Status.ClusterStateSecretName].Data["serverToken"])
+
+	cluster.Spec.RotateJoinTokens = &rkev1.RotateJoinTokens{Generation: 1}
+	planner.process(t, cluster)
+	if cluster.Status.JoinTokenRotationGeneration != 1 || !JoinTokensRotated.IsTrue(&cluster.Status) {
+		t.Fatalf("join token rotation of a cluster without worker-only machines did not finish: %+v", cluster.Status)
+	}
+
+	state := planner.secrets[cluster.Namespace+"/"+cluster.Status.ClusterStateSecretName]
+	if token := string(state.Data["serverToken"]); token == previous || token == "" || len(state.Data["newServerToken"]) > 0 {
+		t.Errorf("new server token was not promoted in the state secret")
+	}
+	if !hasInstruction(planner.plan(t, "machine-1"), "rotate-server-token-1") {
+		t.Error("machine-1 did not rotate the server token")
+	}
+}
@@ -0,0 +1,110 @@
+package planner
+
+import (
+	"fmt"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+const (
+	UpgradePhaseEtcd         = "Etcd"
+	UpgradePhaseControlPlane = "ControlPlane"
+	UpgradePhaseWorkers      = "Workers"
+	UpgradePhaseDone         = "Done"
+)
+
+func upgrading(cluster *rkev1.RKECluster) bool {
+	return cluster.Status.UpgradePhase != "" && cluster.Status.UpgradePhase != UpgradePhaseDone
+}
+
+// upgradeVersion returns the Kubernetes version to roll out. Downgrades, skipped minor versions and version changes
+// during an upgrade are rejected with an error, the current or the upgrade version is rolled out instead. A rollback
+// returns to a version of the plan history the machines already ran, which is never rejected.
+func upgradeVersion(cluster *rkev1.RKECluster) (string, error) {
+	desired := cluster.Spec.KubernetesVersion
+	if rollback := cluster.Spec.PlanRollback; rollback != nil && rollback.Revision != 0 {
+		return desired, nil
+	}
+
+	if upgrading(cluster) {
+		if desired != cluster.Status.UpgradeToVersion {
+			return cluster.Status.UpgradeToVersion, fmt.Errorf("version change to %s is blocked until the upgrade from %s to %s completed",
+				desired, cluster.Status.UpgradeFromVersion, cluster.Status.UpgradeToVersion)
+		}
+		return desired, nil
+	}
+
+	current := cluster.Status.KubernetesVersion
+	if current == "" || current == desired {
+		return desired, nil
+	}
+
+	if err := validateUpgrade(current, desired); err != nil {
+		return current, err
+	}
+	return desired, nil
+}
+
+func validateUpgrade(from, to string) error {
+	if GetRuntime(from) != GetRuntime(to) {
+		return fmt.Errorf("changing the runtime from %s to %s is not supported", GetRuntime(from), GetRuntime(to))
+	}
+
+	fromVersion, err := version.ParseSemantic(from)
+	if err != nil {
+		return fmt.Errorf("invalid version %s: %w", from, err)
+	}
+	toVersion, err := version.ParseSemantic(to)
+	if err != nil {
+		return fmt.Errorf("invalid version %s: %w", to, err)
+	}
+
+	if toVersion.LessThan(fromVersion) {
+		return fmt.Errorf("downgrade from %s to %s is not supported", from, to)
+	}
+	if toVersion.Major() != fromVersion.Major() || toVersion.Minor() > fromVersion.Minor()+1 {
+		return fmt.Errorf("upgrade from %s to %s skips a minor version", from, to)
+	}
+	return nil
+}
+
+// startUpgrade records the upgrade when the version to roll out differs from the version the machines run
+func startUpgrade(cluster *rkev1.RKECluster) {
+	current := cluster.Status.KubernetesVersion
+	if upgrading(cluster) && cluster.Status.UpgradeToVersion != cluster.Spec.KubernetesVersion {
+		// only a rollback changes the version of a running upgrade, which then rolls out the version rolled back to
+		cluster.Status.UpgradeToVersion = cluster.Spec.KubernetesVersion
+		cluster.Status.UpgradePhase = UpgradePhaseEtcd
+		return
+	}
+	if upgrading(cluster) || current == "" || current == cluster.Spec.KubernetesVersion {
+		return
+	}
+
+	cluster.Status.UpgradeFromVersion = current
+	cluster.Status.UpgradeToVersion = cluster.Spec.KubernetesVersion
+	cluster.Status.UpgradePhase = UpgradePhaseEtcd
+	KubernetesVersionUpgraded.Unknown(&cluster.Status)
+	KubernetesVersionUpgraded.Reason(&cluster.Status, "Upgrading")
+}
+
+// setUpgradePhase records which machines are upgraded while an upgrade is running
+func setUpgradePhase(cluster *rkev1.RKECluster, phase string) {
+	if !upgrading(cluster) {
+		return
+	}
+	cluster.Status.UpgradePhase = phase
+	KubernetesVersionUpgraded.Message(&cluster.Status, fmt.Sprintf("upgrading %s machines from %s to %s", phase,
+		cluster.Status.UpgradeFromVersion, cluster.Status.UpgradeToVersion))
+}
+
+// finishUpgrade records the version of the cluster once every machine is in sync
+func finishUpgrade(cluster *rkev1.RKECluster) {
+	cluster.Status.KubernetesVersion = cluster.Spec.KubernetesVersion
+	if !upgrading(cluster) {
+		return
+	}
+	cluster.Status.UpgradePhase = UpgradePhaseDone
+	KubernetesVersionUpgraded.SetError(&cluster.Status, "", nil)
+}
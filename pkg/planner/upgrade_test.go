@@ -0,0 +1,57 @@
+package planner
+
+import (
+	"testing"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+)
+
+func TestValidateUpgrade(t *testing.T) {
+	tests := []struct {
+		from, to string
+		valid    bool
+	}{
+		{"v1.20.4+k3s1", "v1.20.5+k3s1", true},
+		{"v1.20.4+k3s1", "v1.20.4+k3s2", true},
+		{"v1.19.8+k3s1", "v1.20.4+k3s1", true},
+		{"v1.18.8+k3s1", "v1.20.4+k3s1", false},
+		{"v1.20.4+k3s1", "v1.19.8+k3s1", false},
+		{"v1.20.4+k3s1", "v1.20.4+rke2r1", false},
+		{"v1.20.4+k3s1", "latest", false},
+	}
+
+	for _, tt := range tests {
+		if err := validateUpgrade(tt.from, tt.to); (err == nil) != tt.valid {
+			t.Errorf("validateUpgrade(%s, %s) = %v, want valid %v", tt.from, tt.to, err, tt.valid)
+		}
+	}
+}
+
+func TestUpgradeVersion(t *testing.T) {
+	cluster := &rkev1.RKECluster{}
+	cluster.Spec.KubernetesVersion = "v1.19.8+k3s1"
+	cluster.Status.KubernetesVersion = "v1.20.4+k3s1"
+
+	if version, err := upgradeVersion(cluster); err == nil || version != "v1.20.4+k3s1" {
+		t.Errorf("downgrade rolled out %s (%v), want the current version", version, err)
+	}
+
+	cluster.Spec.KubernetesVersion = "v1.20.5+k3s1"
+	startUpgrade(cluster)
+	if cluster.Status.UpgradePhase != UpgradePhaseEtcd || cluster.Status.UpgradeToVersion != "v1.20.5+k3s1" {
+		t.Fatalf("upgrade to %s not started: %+v", cluster.Spec.KubernetesVersion, cluster.Status)
+	}
+
+	// the version is not changed again until the running upgrade is done
+	cluster.Spec.KubernetesVersion = "v1.20.6+k3s1"
+	if version, err := upgradeVersion(cluster); err == nil || version != "v1.20.5+k3s1" {
+		t.Errorf("change during an upgrade rolled out %s (%v), want the upgrade version", version, err)
+	}
+
+	cluster.Spec.KubernetesVersion = "v1.20.5+k3s1"
+	finishUpgrade(cluster)
+	cluster.Spec.KubernetesVersion = "v1.20.6+k3s1"
+	if version, err := upgradeVersion(cluster); err != nil || version != "v1.20.6+k3s1" {
+		t.Errorf("upgrade after a finished upgrade rolled out %s (%v)", version, err)
+	}
+}
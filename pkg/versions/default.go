@@ -0,0 +1,23 @@
+package versions
+
+// defaultCatalog is used when neither the kubernetes-versions ConfigMap nor the kubernetes-versions setting is set
+const defaultCatalog = `
+default: v1.20.4+k3s1
+versions:
+- version: v1.20.4+k3s1
+  installerImage: rancher/system-agent-installer-k3s:v1.20.4-k3s1
+  runtimes:
+  - k3s
+- version: v1.19.8+k3s1
+  installerImage: rancher/system-agent-installer-k3s:v1.19.8-k3s1
+  runtimes:
+  - k3s
+- version: v1.20.4+rke2r1
+  installerImage: rancher/system-agent-installer-rke2:v1.20.4-rke2r1
+  runtimes:
+  - rke2
+- version: v1.19.8+rke2r1
+  installerImage: rancher/system-agent-installer-rke2:v1.19.8-rke2r1
+  runtimes:
+  - rke2
+`
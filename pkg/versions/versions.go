@@ -0,0 +1,147 @@
+package versions
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rancher/rancher-operator/pkg/clients"
+	mgmtcontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/rancher-operator/pkg/namespaces"
+	"github.com/rancher/rancher-operator/pkg/settings"
+	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	// ConfigMapName is the name of the ConfigMap in the cattle-system namespace that holds the catalog
+	ConfigMapName = "kubernetes-versions"
+	// ConfigMapKey is the key of the ConfigMap that holds the catalog
+	ConfigMapKey = "versions.yaml"
+	// SettingName is the name of the setting that holds the catalog, used if the ConfigMap does not exist
+	SettingName = "kubernetes-versions"
+
+	// SystemDefaultRegistrySetting is the setting used to prefix installer images
+	SystemDefaultRegistrySetting = "system-default-registry"
+)
+
+var (
+	ErrUnknownVersion = errors.New("unknown kubernetes version")
+	ErrInvalidCatalog = errors.New("invalid kubernetes version catalog")
+)
+
+type Catalog struct {
+	// Default is the version of clusters without a Kubernetes version, the first version if empty
+	Default  string    `json:"default,omitempty"`
+	Versions []Version `json:"versions,omitempty"`
+}
+
+type Version struct {
+	Version        string                 `json:"version,omitempty"`
+	InstallerImage string                 `json:"installerImage,omitempty"`
+	Runtimes       []string               `json:"runtimes,omitempty"`
+	DefaultConfig  map[string]interface{} `json:"defaultConfig,omitempty"`
+}
+
+func (v *Version) SupportsRuntime(runtime string) bool {
+	if len(v.Runtimes) == 0 {
+		return true
+	}
+	for _, supported := range v.Runtimes {
+		if supported == runtime {
+			return true
+		}
+	}
+	return false
+}
+
+type Manager struct {
+	configMapCache corecontrollers.ConfigMapCache
+	settings       mgmtcontrollers.SettingCache
+}
+
+func New(clients *clients.Clients) *Manager {
+	return &Manager{
+		configMapCache: clients.Core.ConfigMap().Cache(),
+		settings:       clients.Management.Setting().Cache(),
+	}
+}
+
+// Get returns the catalog entry for the given Kubernetes version with the installer image prefixed by the
+// system-default-registry setting, the default entry if the version is empty. ErrUnknownVersion is returned if the
+// catalog has no such entry and ErrInvalidCatalog if the catalog can not be read.
+func (m *Manager) Get(kubernetesVersion string) (*Version, error) {
+	catalog, err := m.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	if kubernetesVersion == "" {
+		kubernetesVersion = catalog.DefaultVersion()
+	}
+
+	for _, version := range catalog.Versions {
+		if version.Version != kubernetesVersion {
+			continue
+		}
+
+		registry, err := settings.Get(m.settings, SystemDefaultRegistrySetting)
+		if err != nil && !apierror.IsNotFound(err) {
+			return nil, err
+		}
+
+		version.InstallerImage = prefixRegistry(registry, version.InstallerImage)
+		return &version, nil
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnknownVersion, kubernetesVersion)
+}
+
+// Catalog returns the catalog from the kubernetes-versions ConfigMap, the kubernetes-versions setting, or the
+// built in default, in that order.
+func (m *Manager) Catalog() (*Catalog, error) {
+	configMap, err := m.configMapCache.Get(namespaces.System, ConfigMapName)
+	if err == nil {
+		data, ok := configMap.Data[ConfigMapKey]
+		if !ok {
+			return nil, fmt.Errorf("%w: ConfigMap %s/%s has no key %s", ErrInvalidCatalog, namespaces.System, ConfigMapName, ConfigMapKey)
+		}
+		return parse(data)
+	} else if !apierror.IsNotFound(err) {
+		return nil, err
+	}
+
+	data, err := settings.Get(m.settings, SettingName)
+	if err == nil && data != "" {
+		return parse(data)
+	} else if err != nil && !apierror.IsNotFound(err) {
+		return nil, err
+	}
+
+	return parse(defaultCatalog)
+}
+
+// DefaultVersion returns the version of clusters without a Kubernetes version
+func (c *Catalog) DefaultVersion() string {
+	if c.Default != "" || len(c.Versions) == 0 {
+		return c.Default
+	}
+	return c.Versions[0].Version
+}
+
+func parse(data string) (*Catalog, error) {
+	catalog := &Catalog{}
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewBufferString(data), 4096).Decode(catalog); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCatalog, err)
+	}
+	return catalog, nil
+}
+
+func prefixRegistry(registry, image string) string {
+	if registry == "" {
+		return image
+	}
+	return strings.TrimSuffix(registry, "/") + "/" + strings.TrimPrefix(image, "docker.io/")
+}
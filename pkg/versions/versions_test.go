@@ -0,0 +1,70 @@
+package versions
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	catalog, err := parse(defaultCatalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog.Versions) == 0 {
+		t.Fatal("default catalog has no versions")
+	}
+
+	found := false
+	for _, version := range catalog.Versions {
+		if version.Version == catalog.DefaultVersion() {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("default version %s is not in the default catalog", catalog.DefaultVersion())
+	}
+
+	if _, err := parse("versions: {"); !errors.Is(err, ErrInvalidCatalog) {
+		t.Errorf("parse() of invalid YAML = %v, want %v", err, ErrInvalidCatalog)
+	}
+}
+
+func TestDefaultVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		catalog Catalog
+		want    string
+	}{
+		{"empty", Catalog{}, ""},
+		{"first version", Catalog{Versions: []Version{{Version: "v1.20.4+k3s1"}, {Version: "v1.19.8+k3s1"}}}, "v1.20.4+k3s1"},
+		{"default", Catalog{Default: "v1.19.8+k3s1", Versions: []Version{{Version: "v1.20.4+k3s1"}}}, "v1.19.8+k3s1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.catalog.DefaultVersion(); got != tt.want {
+				t.Errorf("DefaultVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefixRegistry(t *testing.T) {
+	tests := []struct {
+		registry string
+		image    string
+		want     string
+	}{
+		{"", "rancher/installer:v1", "rancher/installer:v1"},
+		{"registry.example.com", "rancher/installer:v1", "registry.example.com/rancher/installer:v1"},
+		{"registry.example.com/", "docker.io/rancher/installer:v1", "registry.example.com/rancher/installer:v1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.registry+"/"+tt.image, func(t *testing.T) {
+			if got := prefixRegistry(tt.registry, tt.image); got != tt.want {
+				t.Errorf("prefixRegistry(%q, %q) = %q, want %q", tt.registry, tt.image, got, tt.want)
+			}
+		})
+	}
+}
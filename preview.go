@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/rancher/rancher-operator/pkg/clients"
+	rkeplanner "github.com/rancher/rancher-operator/pkg/controllers/rke/planner"
+	"github.com/rancher/rancher-operator/pkg/planner"
+	"github.com/rancher/wrangler/pkg/kubeconfig"
+	"github.com/rancher/wrangler/pkg/signals"
+	"github.com/urfave/cli"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	PreviewNamespace string
+	PreviewName      string
+	PreviewFile      string
+)
+
+var previewCommand = cli.Command{
+	Name:  "preview",
+	Usage: "Show the plan changes of each machine of a cluster for a proposed cluster, without applying them",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:        "namespace",
+			Value:       "fleet-default",
+			Destination: &PreviewNamespace,
+		},
+		cli.StringFlag{
+			Name:        "name",
+			Usage:       "Name of the rancher cluster",
+			Destination: &PreviewName,
+		},
+		cli.StringFlag{
+			Name:        "file",
+			Usage:       "YAML or JSON file with the proposed cluster or cluster spec, the current spec is used if not set",
+			Destination: &PreviewFile,
+		},
+	},
+	Action: preview,
+}
+
+func preview(c *cli.Context) error {
+	if PreviewName == "" {
+		return fmt.Errorf("--name is required")
+	}
+
+	ctx := signals.SetupSignalHandler(context.Background())
+	clientConfig := kubeconfig.GetNonInteractiveClientConfigWithContext(KubeConfig, Context)
+
+	clients, err := clients.New(clientConfig)
+	if err != nil {
+		return err
+	}
+
+	p := planner.New(ctx, clients)
+	rkeClusterCache := clients.RKE.RKECluster().Cache()
+	if err := clients.Start(ctx); err != nil {
+		return err
+	}
+
+	cluster, err := clients.Cluster.Cluster().Get(PreviewNamespace, PreviewName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	data := ""
+	if PreviewFile != "" {
+		bytes, err := ioutil.ReadFile(PreviewFile)
+		if err != nil {
+			return err
+		}
+		data = string(bytes)
+	}
+
+	spec, err := rkeplanner.ParsePreviewSpec(data)
+	if err != nil {
+		return err
+	}
+
+	preview, err := rkeplanner.Preview(p, rkeClusterCache, cluster, spec)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(planner.FormatPreview(preview))
+	return nil
+}